@@ -0,0 +1,204 @@
+// Package anim plays frame sequences cut from sprite sheets.
+//
+// A Sheet divides an image into equal cells and names clips, each a list of
+// frames showing one cell. An Animator plays one clip at a time, advancing
+// either with time or with the distance its character moved, so walk cycles
+// keep pace with the feet. The package never touches images itself, so it
+// runs headless; drawing is left to the game.
+package anim
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"math"
+)
+
+// TicksPerSecond is how often Update is called, the game's tick rate
+const TicksPerSecond = 60
+
+// Clip names characters choose from
+const (
+	Idle      = "idle"       // Standing still, also played for clips a sheet lacks
+	WalkUp    = "walk_up"    // Walking away from the viewer
+	WalkDown  = "walk_down"  // Walking towards the viewer
+	WalkLeft  = "walk_left"  // Walking to the left
+	WalkRight = "walk_right" // Walking to the right
+	Bow       = "bow"        // Bowing, e.g. at the torii
+	Clap      = "clap"       // Clapping hands in prayer
+)
+
+// walkThreshold is the speed in pixels per tick below which a character stands
+const walkThreshold = 0.1
+
+// Frame is one picture of a clip
+type Frame struct {
+	Cell  int     `json:"cell"` // Cell of the sheet, counted row by row from the top left
+	DX    float64 `json:"dx"`   // Offset in screen pixels, e.g. for a bob drawn without its own cell
+	DY    float64 `json:"dy"`
+	FlipX bool    `json:"flipX"` // Mirror the cell, e.g. to walk left with right-facing cells
+}
+
+// Clip is a sequence of frames
+type Clip struct {
+	Frames []Frame `json:"frames"`
+	FPS    float64 `json:"fps"`    // Frames per second for clips played over time
+	Stride float64 `json:"stride"` // Pixels moved per frame for clips played by movement, FPS is ignored if set
+	Loop   bool    `json:"loop"`   // Start over after the last frame instead of holding it
+}
+
+// Sheet is a sprite sheet and the clips cut from it
+type Sheet struct {
+	Image       string           `json:"image"`      // Image file
+	FrameWidth  int              `json:"frameWidth"` // Cell size in pixels, the whole image if zero
+	FrameHeight int              `json:"frameHeight"`
+	Clips       map[string]*Clip `json:"clips"`
+}
+
+// sheetFile is the layout of an animation data file
+type sheetFile struct {
+	Sheets []*Sheet `json:"sheets"`
+}
+
+// Parse reads sheets from JSON and checks their clips
+func Parse(data []byte) ([]*Sheet, error) {
+	var f sheetFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing animations: %w", err)
+	}
+	for _, s := range f.Sheets {
+		if s.Image == "" {
+			return nil, fmt.Errorf("sheet without an image")
+		}
+		if s.FrameWidth < 0 || s.FrameHeight < 0 {
+			return nil, fmt.Errorf("sheet %s: negative frame size", s.Image)
+		}
+		for name, c := range s.Clips {
+			if len(c.Frames) == 0 {
+				return nil, fmt.Errorf("sheet %s: clip %q has no frames", s.Image, name)
+			}
+			if len(c.Frames) > 1 && c.FPS <= 0 && c.Stride <= 0 {
+				return nil, fmt.Errorf("sheet %s: clip %q needs an fps or a stride", s.Image, name)
+			}
+			for _, f := range c.Frames {
+				if f.Cell < 0 {
+					return nil, fmt.Errorf("sheet %s: clip %q uses a negative cell", s.Image, name)
+				}
+			}
+		}
+	}
+	return f.Sheets, nil
+}
+
+// Cells returns the cells of an image of the given size, row by row
+func (s *Sheet) Cells(imageWidth, imageHeight int) []image.Rectangle {
+	w, h := s.FrameWidth, s.FrameHeight
+	if w == 0 {
+		w = imageWidth
+	}
+	if h == 0 {
+		h = imageHeight
+	}
+	var cells []image.Rectangle
+	for y := 0; y+h <= imageHeight; y += h {
+		for x := 0; x+w <= imageWidth; x += w {
+			cells = append(cells, image.Rect(x, y, x+w, y+h))
+		}
+	}
+	return cells
+}
+
+// MaxCell returns the highest cell any clip shows
+func (s *Sheet) MaxCell() int {
+	highest := 0
+	for _, c := range s.Clips {
+		for _, f := range c.Frames {
+			if f.Cell > highest {
+				highest = f.Cell
+			}
+		}
+	}
+	return highest
+}
+
+// Clip returns the named clip, or Idle if the sheet lacks it. It returns nil
+// if the sheet has neither, and the character shows cell 0.
+func (s *Sheet) Clip(name string) *Clip {
+	if c, ok := s.Clips[name]; ok {
+		return c
+	}
+	return s.Clips[Idle]
+}
+
+// WalkClip returns the clip for moving with the given velocity: the walk
+// towards the main direction of travel, or Idle when standing
+func WalkClip(vx, vy float64) string {
+	switch {
+	case math.Hypot(vx, vy) < walkThreshold:
+		return Idle
+	case math.Abs(vx) > math.Abs(vy) && vx < 0:
+		return WalkLeft
+	case math.Abs(vx) > math.Abs(vy):
+		return WalkRight
+	case vy < 0:
+		return WalkUp
+	}
+	return WalkDown
+}
+
+// Animator plays the clips of one character. The zero value plays Idle.
+type Animator struct {
+	clip     string
+	position float64 // Frames played, with the fraction of the current one
+}
+
+// Play switches to the named clip and starts it from its first frame.
+// Playing the clip that is already running keeps it going.
+func (a *Animator) Play(name string) {
+	if name != a.clip {
+		a.clip = name
+		a.position = 0
+	}
+}
+
+// Clip returns the name of the clip being played
+func (a *Animator) Clip() string {
+	if a.clip == "" {
+		return Idle
+	}
+	return a.clip
+}
+
+// Update advances the clip by one tick. distance is how far the character
+// moved this tick in pixels, which drives clips with a stride.
+func (a *Animator) Update(s *Sheet, distance float64) {
+	c := s.Clip(a.Clip())
+	if c == nil {
+		return
+	}
+	if c.Stride > 0 {
+		a.position += distance / c.Stride
+	} else {
+		a.position += c.FPS / TicksPerSecond
+	}
+	if n := float64(len(c.Frames)); a.position >= n {
+		if c.Loop {
+			a.position = math.Mod(a.position, n)
+		} else {
+			a.position = n - 1
+		}
+	}
+}
+
+// Frame returns the frame to show now
+func (a *Animator) Frame(s *Sheet) Frame {
+	c := s.Clip(a.Clip())
+	if c == nil {
+		return Frame{}
+	}
+	i := int(a.position)
+	if i >= len(c.Frames) {
+		i = len(c.Frames) - 1
+	}
+	return c.Frames[i]
+}
@@ -0,0 +1,149 @@
+package anim
+
+import (
+	"image"
+	"reflect"
+	"testing"
+)
+
+// testSheet has a timed looping clip, a held clip and a walk driven by distance
+func testSheet() *Sheet {
+	return &Sheet{Clips: map[string]*Clip{
+		Idle:     {Frames: []Frame{{Cell: 0}, {Cell: 1}}, FPS: 30, Loop: true},
+		Bow:      {Frames: []Frame{{Cell: 2}, {Cell: 3}}, FPS: 60},
+		WalkDown: {Frames: []Frame{{Cell: 4}, {Cell: 5}}, Stride: 4, Loop: true},
+	}}
+}
+
+func TestTimedClipLoops(t *testing.T) {
+	s := testSheet()
+	var a Animator
+	var cells []int
+	for i := 0; i < 8; i++ {
+		cells = append(cells, a.Frame(s).Cell)
+		a.Update(s, 0)
+	}
+	// 30 fps at 60 ticks per second shows each frame for two ticks
+	if want := []int{0, 0, 1, 1, 0, 0, 1, 1}; !reflect.DeepEqual(cells, want) {
+		t.Errorf("cells = %v, want %v", cells, want)
+	}
+}
+
+func TestClipWithoutLoopHoldsLastFrame(t *testing.T) {
+	s := testSheet()
+	var a Animator
+	a.Play(Bow)
+	for i := 0; i < 10; i++ {
+		a.Update(s, 0)
+	}
+	if got := a.Frame(s).Cell; got != 3 {
+		t.Errorf("cell = %d, want 3", got)
+	}
+}
+
+func TestStrideFollowsDistance(t *testing.T) {
+	s := testSheet()
+	var a Animator
+	a.Play(WalkDown)
+	a.Update(s, 1)
+	if got := a.Frame(s).Cell; got != 4 {
+		t.Errorf("after 1px cell = %d, want 4", got)
+	}
+	a.Update(s, 3)
+	if got := a.Frame(s).Cell; got != 5 {
+		t.Errorf("after 4px cell = %d, want 5", got)
+	}
+	// Standing in place holds the frame however many ticks pass
+	for i := 0; i < 100; i++ {
+		a.Update(s, 0)
+	}
+	if got := a.Frame(s).Cell; got != 5 {
+		t.Errorf("after standing cell = %d, want 5", got)
+	}
+}
+
+func TestPlayRestartsOnlyNewClips(t *testing.T) {
+	s := testSheet()
+	var a Animator
+	a.Play(WalkDown)
+	a.Update(s, 4)
+	a.Play(WalkDown)
+	if got := a.Frame(s).Cell; got != 5 {
+		t.Errorf("replaying the same clip restarted it, cell = %d", got)
+	}
+	a.Play(Bow)
+	if got := a.Frame(s).Cell; got != 2 {
+		t.Errorf("new clip cell = %d, want 2", got)
+	}
+}
+
+func TestMissingClipFallsBackToIdle(t *testing.T) {
+	s := testSheet()
+	var a Animator
+	a.Play(Clap)
+	if got := a.Frame(s).Cell; got != 0 {
+		t.Errorf("cell = %d, want idle's 0", got)
+	}
+	empty := &Sheet{}
+	a.Update(empty, 1)
+	if got := a.Frame(empty); got != (Frame{}) {
+		t.Errorf("frame of empty sheet = %+v, want zero", got)
+	}
+}
+
+func TestWalkClip(t *testing.T) {
+	tests := []struct {
+		vx, vy float64
+		want   string
+	}{
+		{0, 0, Idle},
+		{0.05, 0, Idle},
+		{-1, 0.5, WalkLeft},
+		{1, -0.5, WalkRight},
+		{0.5, -1, WalkUp},
+		{0, 1, WalkDown},
+	}
+	for _, tt := range tests {
+		if got := WalkClip(tt.vx, tt.vy); got != tt.want {
+			t.Errorf("WalkClip(%v, %v) = %s, want %s", tt.vx, tt.vy, got, tt.want)
+		}
+	}
+}
+
+func TestCells(t *testing.T) {
+	s := &Sheet{FrameWidth: 16, FrameHeight: 32}
+	cells := s.Cells(48, 64)
+	if len(cells) != 6 {
+		t.Fatalf("got %d cells, want 6", len(cells))
+	}
+	if want := image.Rect(16, 32, 32, 64); cells[4] != want {
+		t.Errorf("cell 4 = %v, want %v", cells[4], want)
+	}
+	whole := (&Sheet{}).Cells(48, 64)
+	if len(whole) != 1 || whole[0] != image.Rect(0, 0, 48, 64) {
+		t.Errorf("sheet without a frame size = %v, want the whole image", whole)
+	}
+}
+
+func TestParse(t *testing.T) {
+	sheets, err := Parse([]byte(`{"sheets": [{"image": "a.png", "frameWidth": 8, "frameHeight": 8,
+		"clips": {"idle": {"frames": [{"cell": 0}]}, "bow": {"fps": 4, "frames": [{"cell": 1}, {"cell": 3, "dy": 2}]}}}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sheets) != 1 || sheets[0].MaxCell() != 3 || sheets[0].Clips[Bow].Frames[1].DY != 2 {
+		t.Errorf("unexpected sheets %+v", sheets)
+	}
+
+	bad := []string{
+		`{"sheets": [{"clips": {}}]}`,
+		`{"sheets": [{"image": "a.png", "clips": {"idle": {"frames": []}}}]}`,
+		`{"sheets": [{"image": "a.png", "clips": {"idle": {"frames": [{"cell": 0}, {"cell": 1}]}}}]}`,
+		`{"sheets": [{"image": "a.png", "clips": {"idle": {"frames": [{"cell": -1}]}}}]}`,
+	}
+	for _, data := range bad {
+		if _, err := Parse([]byte(data)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", data)
+		}
+	}
+}
@@ -0,0 +1,231 @@
+// Package behavior is a small behavior tree framework for NPCs.
+//
+// A tree is built from composite nodes (Sequence, Selector, Random) and leaf
+// nodes (MoveTo, Wait, Interact, Action) and ticked once per frame. Leaves
+// that need the game world call into an Agent, so the package itself knows
+// nothing about maps, paths or sprites and runs headless.
+package behavior
+
+// Status is the result of ticking a node
+type Status int
+
+const (
+	Running Status = iota // The node needs more frames
+	Success               // The node finished
+	Failure               // The node could not finish
+)
+
+// String returns the name of the status
+func (s Status) String() string {
+	switch s {
+	case Running:
+		return "Running"
+	case Success:
+		return "Success"
+	case Failure:
+		return "Failure"
+	}
+	return "Unknown"
+}
+
+// Agent is the NPC a tree controls. Targets and actions are names, so trees
+// can be described in data files and the agent decides what they mean.
+type Agent interface {
+	// MoveTo moves one frame towards the named target. frame counts the
+	// frames since this move started, so frame 0 is the place to plan.
+	MoveTo(target string, frame int) Status
+	// Interact performs one frame of the named action. frame counts the
+	// frames since the action started.
+	Interact(action string, frame int) Status
+}
+
+// Node is a node of a behavior tree
+type Node interface {
+	// Tick advances the node by one frame
+	Tick(agent Agent) Status
+	// Reset makes the node start over on its next tick
+	Reset()
+}
+
+// RandomSource provides random numbers in [0, 1), for example *rand.Rand
+type RandomSource interface {
+	Float64() float64
+}
+
+// leaf runs a function with a frame counter until it stops running
+type leaf struct {
+	run   func(agent Agent, frame int) Status
+	frame int
+}
+
+func (l *leaf) Tick(agent Agent) Status {
+	status := l.run(agent, l.frame)
+	l.frame++
+	if status != Running {
+		l.frame = 0
+	}
+	return status
+}
+
+func (l *leaf) Reset() {
+	l.frame = 0
+}
+
+// MoveTo walks the agent to the named target
+func MoveTo(target string) Node {
+	return &leaf{run: func(agent Agent, frame int) Status {
+		return agent.MoveTo(target, frame)
+	}}
+}
+
+// Interact makes the agent perform the named action
+func Interact(action string) Node {
+	return &leaf{run: func(agent Agent, frame int) Status {
+		return agent.Interact(action, frame)
+	}}
+}
+
+// Wait does nothing for the given number of frames and then succeeds
+func Wait(frames int) Node {
+	return &leaf{run: func(agent Agent, frame int) Status {
+		if frame+1 >= frames {
+			return Success
+		}
+		return Running
+	}}
+}
+
+// Action runs a Go function every frame until it stops running
+func Action(run func(agent Agent, frame int) Status) Node {
+	return &leaf{run: run}
+}
+
+// Succeed always succeeds right away
+func Succeed() Node {
+	return Action(func(Agent, int) Status { return Success })
+}
+
+// Fail always fails right away
+func Fail() Node {
+	return Action(func(Agent, int) Status { return Failure })
+}
+
+// composite remembers which child is running
+type composite struct {
+	children []Node
+	current  int
+}
+
+func (c *composite) Reset() {
+	for _, child := range c.children {
+		child.Reset()
+	}
+	c.current = 0
+}
+
+// sequence runs its children in order
+type sequence struct {
+	composite
+}
+
+// Sequence runs its children one after another. It fails as soon as a child
+// fails and succeeds once all of them succeeded.
+func Sequence(children ...Node) Node {
+	return &sequence{composite{children: children}}
+}
+
+func (s *sequence) Tick(agent Agent) Status {
+	for s.current < len(s.children) {
+		switch s.children[s.current].Tick(agent) {
+		case Running:
+			return Running
+		case Failure:
+			s.Reset()
+			return Failure
+		}
+		s.current++
+	}
+	s.Reset()
+	return Success
+}
+
+// selector tries its children in order
+type selector struct {
+	composite
+}
+
+// Selector tries its children one after another until one succeeds. It fails
+// if all of them fail.
+func Selector(children ...Node) Node {
+	return &selector{composite{children: children}}
+}
+
+func (s *selector) Tick(agent Agent) Status {
+	for s.current < len(s.children) {
+		switch s.children[s.current].Tick(agent) {
+		case Running:
+			return Running
+		case Success:
+			s.Reset()
+			return Success
+		}
+		s.current++
+	}
+	s.Reset()
+	return Failure
+}
+
+// Choice is a child of Random with its relative weight
+type Choice struct {
+	Weight float64
+	Node   Node
+}
+
+// random runs one child chosen at random
+type random struct {
+	source  RandomSource
+	choices []Choice
+	current int // Index of the chosen child, -1 if none is running
+}
+
+// Random picks one of its children by weight and runs it to completion,
+// returning its result. The next run picks again.
+func Random(source RandomSource, choices ...Choice) Node {
+	return &random{source: source, choices: choices, current: -1}
+}
+
+func (r *random) Tick(agent Agent) Status {
+	if len(r.choices) == 0 {
+		return Failure
+	}
+	if r.current < 0 {
+		r.current = r.pick()
+	}
+	status := r.choices[r.current].Node.Tick(agent)
+	if status != Running {
+		r.current = -1
+	}
+	return status
+}
+
+func (r *random) pick() int {
+	total := 0.0
+	for _, c := range r.choices {
+		total += c.Weight
+	}
+	x := r.source.Float64() * total
+	for i, c := range r.choices {
+		if x < c.Weight {
+			return i
+		}
+		x -= c.Weight
+	}
+	return len(r.choices) - 1
+}
+
+func (r *random) Reset() {
+	if r.current >= 0 {
+		r.choices[r.current].Node.Reset()
+	}
+	r.current = -1
+}
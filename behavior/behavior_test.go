@@ -0,0 +1,261 @@
+package behavior
+
+import (
+	"reflect"
+	"testing"
+)
+
+// fakeAgent records calls and answers them from scripted durations
+type fakeAgent struct {
+	moveFrames     map[string]int // Frames a move takes, missing targets fail
+	interactFrames map[string]int // Frames an action takes, missing actions fail
+	log            []string
+}
+
+func (a *fakeAgent) MoveTo(target string, frame int) Status {
+	a.log = append(a.log, "move:"+target)
+	return scripted(a.moveFrames, target, frame)
+}
+
+func (a *fakeAgent) Interact(action string, frame int) Status {
+	a.log = append(a.log, "interact:"+action)
+	return scripted(a.interactFrames, action, frame)
+}
+
+func scripted(frames map[string]int, name string, frame int) Status {
+	n, ok := frames[name]
+	if !ok {
+		return Failure
+	}
+	if frame+1 >= n {
+		return Success
+	}
+	return Running
+}
+
+// fixedSource returns the same number every time
+type fixedSource float64
+
+func (s fixedSource) Float64() float64 { return float64(s) }
+
+// run ticks the node until it stops running and returns its status and the
+// number of ticks it took
+func run(t *testing.T, node Node, agent Agent) (Status, int) {
+	t.Helper()
+	for ticks := 1; ticks <= 1000; ticks++ {
+		if status := node.Tick(agent); status != Running {
+			return status, ticks
+		}
+	}
+	t.Fatal("node is still running after 1000 ticks")
+	return Running, 0
+}
+
+func TestWait(t *testing.T) {
+	wait := Wait(5)
+	status, ticks := run(t, wait, &fakeAgent{})
+	if status != Success || ticks != 5 {
+		t.Errorf("Wait(5) = %v after %d ticks, want Success after 5", status, ticks)
+	}
+
+	// The node starts over once it finished
+	status, ticks = run(t, wait, &fakeAgent{})
+	if status != Success || ticks != 5 {
+		t.Errorf("second Wait(5) = %v after %d ticks, want Success after 5", status, ticks)
+	}
+}
+
+func TestMoveToAndInteractPassFrames(t *testing.T) {
+	var frames []int
+	agent := &recordingAgent{frames: &frames}
+	node := Sequence(MoveTo("a"), Interact("b"))
+	status, _ := run(t, node, agent)
+	if status != Success {
+		t.Fatalf("status = %v, want Success", status)
+	}
+	want := []int{0, 1, 2, 0, 1, 2}
+	if !reflect.DeepEqual(frames, want) {
+		t.Errorf("frames = %v, want %v", frames, want)
+	}
+}
+
+// recordingAgent takes three frames for everything and records the frame numbers
+type recordingAgent struct {
+	frames *[]int
+}
+
+func (a *recordingAgent) MoveTo(target string, frame int) Status {
+	*a.frames = append(*a.frames, frame)
+	return scripted(map[string]int{target: 3}, target, frame)
+}
+
+func (a *recordingAgent) Interact(action string, frame int) Status {
+	*a.frames = append(*a.frames, frame)
+	return scripted(map[string]int{action: 3}, action, frame)
+}
+
+func TestSequence(t *testing.T) {
+	agent := &fakeAgent{
+		moveFrames:     map[string]int{"temizuya": 2},
+		interactFrames: map[string]int{"purify": 3},
+	}
+	// The next child starts in the same tick the previous one finished
+	status, ticks := run(t, Sequence(MoveTo("temizuya"), Interact("purify")), agent)
+	if status != Success || ticks != 4 {
+		t.Errorf("sequence = %v after %d ticks, want Success after 4", status, ticks)
+	}
+	want := []string{"move:temizuya", "move:temizuya", "interact:purify", "interact:purify", "interact:purify"}
+	if !reflect.DeepEqual(agent.log, want) {
+		t.Errorf("log = %v, want %v", agent.log, want)
+	}
+}
+
+func TestSequenceStopsAtFailure(t *testing.T) {
+	agent := &fakeAgent{interactFrames: map[string]int{"pray": 1}}
+	status, _ := run(t, Sequence(MoveTo("nowhere"), Interact("pray")), agent)
+	if status != Failure {
+		t.Errorf("status = %v, want Failure", status)
+	}
+	if want := []string{"move:nowhere"}; !reflect.DeepEqual(agent.log, want) {
+		t.Errorf("log = %v, want %v", agent.log, want)
+	}
+}
+
+func TestSelector(t *testing.T) {
+	agent := &fakeAgent{moveFrames: map[string]int{"exit": 2}}
+	status, _ := run(t, Selector(MoveTo("nowhere"), MoveTo("exit"), MoveTo("never")), agent)
+	if status != Success {
+		t.Errorf("status = %v, want Success", status)
+	}
+	want := []string{"move:nowhere", "move:exit", "move:exit"}
+	if !reflect.DeepEqual(agent.log, want) {
+		t.Errorf("log = %v, want %v", agent.log, want)
+	}
+
+	status, _ = run(t, Selector(Fail(), Fail()), agent)
+	if status != Failure {
+		t.Errorf("selector of failures = %v, want Failure", status)
+	}
+}
+
+func TestSelectorSkipsFailedStep(t *testing.T) {
+	// A stop that cannot be visited is skipped and the visit carries on
+	agent := &fakeAgent{moveFrames: map[string]int{"exit": 1}}
+	visit := Sequence(
+		Selector(Sequence(MoveTo("closed"), Interact("pray")), Succeed()),
+		MoveTo("exit"),
+	)
+	status, _ := run(t, visit, agent)
+	if status != Success {
+		t.Errorf("status = %v, want Success", status)
+	}
+	if want := []string{"move:closed", "move:exit"}; !reflect.DeepEqual(agent.log, want) {
+		t.Errorf("log = %v, want %v", agent.log, want)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	for _, tt := range []struct {
+		source float64
+		want   string
+	}{
+		{0.0, "move:a"},
+		{0.24, "move:a"},
+		{0.26, "move:b"},
+		{0.99, "move:b"},
+	} {
+		agent := &fakeAgent{moveFrames: map[string]int{"a": 1, "b": 1}}
+		node := Random(fixedSource(tt.source), Choice{1, MoveTo("a")}, Choice{3, MoveTo("b")})
+		run(t, node, agent)
+		if len(agent.log) != 1 || agent.log[0] != tt.want {
+			t.Errorf("source %v: log = %v, want [%s]", tt.source, agent.log, tt.want)
+		}
+	}
+}
+
+// sequenceSource returns the given numbers in turn
+type sequenceSource struct {
+	values []float64
+}
+
+func (s *sequenceSource) Float64() float64 {
+	v := s.values[0]
+	s.values = s.values[1:]
+	return v
+}
+
+func TestRandomKeepsChoiceWhileRunning(t *testing.T) {
+	agent := &fakeAgent{moveFrames: map[string]int{"a": 3, "b": 3}}
+	source := &sequenceSource{values: []float64{0.1, 0.9}}
+	node := Random(source, Choice{1, MoveTo("a")}, Choice{1, MoveTo("b")})
+
+	run(t, node, agent)
+	run(t, node, agent)
+	want := []string{"move:a", "move:a", "move:a", "move:b", "move:b", "move:b"}
+	if !reflect.DeepEqual(agent.log, want) {
+		t.Errorf("log = %v, want %v", agent.log, want)
+	}
+}
+
+func TestReset(t *testing.T) {
+	agent := &fakeAgent{moveFrames: map[string]int{"a": 3, "b": 1}}
+	node := Sequence(MoveTo("a"), MoveTo("b"))
+	node.Tick(agent)
+	node.Tick(agent)
+	node.Reset()
+	agent.log = nil
+
+	status, ticks := run(t, node, agent)
+	if status != Success || ticks != 3 {
+		t.Errorf("after Reset = %v after %d ticks, want Success after 3", status, ticks)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	spec, err := Parse([]byte(`{"type": "sequence", "children": [
+		{"type": "moveTo", "target": "torii"},
+		{"type": "interact", "action": "bow"},
+		{"type": "selector", "children": [
+			{"type": "moveTo", "target": "closed"},
+			{"type": "wait", "frames": 2}
+		]},
+		{"type": "random", "children": [
+			{"type": "moveTo", "target": "sacredTree", "weight": 3},
+			{"type": "succeed"}
+		]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node, err := Build(spec, fixedSource(0.5))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	agent := &fakeAgent{
+		moveFrames:     map[string]int{"torii": 1, "sacredTree": 1},
+		interactFrames: map[string]int{"bow": 1},
+	}
+	status, ticks := run(t, node, agent)
+	if status != Success || ticks != 2 {
+		t.Errorf("built tree = %v after %d ticks, want Success after 2", status, ticks)
+	}
+	want := []string{"move:torii", "interact:bow", "move:closed", "move:sacredTree"}
+	if !reflect.DeepEqual(agent.log, want) {
+		t.Errorf("log = %v, want %v", agent.log, want)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	for _, spec := range []Spec{
+		{Type: "teleport"},
+		{Type: "moveTo"},
+		{Type: "interact"},
+		{Type: "sequence", Children: []Spec{{Type: "moveTo"}}},
+		{Type: "random", Children: []Spec{{Type: "succeed"}}}, // No random source
+	} {
+		if _, err := Build(spec, nil); err == nil {
+			t.Errorf("Build(%+v) succeeded, want an error", spec)
+		}
+	}
+}
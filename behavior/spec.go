@@ -0,0 +1,87 @@
+package behavior
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Spec describes a tree in data, for example in a JSON file:
+//
+//	{"type": "sequence", "children": [
+//	    {"type": "moveTo", "target": "temizuya"},
+//	    {"type": "interact", "action": "purify"},
+//	    {"type": "random", "children": [
+//	        {"type": "wait", "frames": 60, "weight": 2},
+//	        {"type": "moveTo", "target": "sacredTree"}
+//	    ]}
+//	]}
+type Spec struct {
+	Type     string  `json:"type"`             // sequence, selector, random, moveTo, interact, wait, succeed or fail
+	Target   string  `json:"target,omitempty"` // moveTo
+	Action   string  `json:"action,omitempty"` // interact
+	Frames   int     `json:"frames,omitempty"` // wait
+	Weight   float64 `json:"weight,omitempty"` // Weight as a child of random, 1 if zero
+	Children []Spec  `json:"children,omitempty"`
+}
+
+// Parse reads a Spec from JSON
+func Parse(data []byte) (Spec, error) {
+	var spec Spec
+	if err := json.Unmarshal(data, &spec); err != nil {
+		return Spec{}, fmt.Errorf("parsing behavior: %w", err)
+	}
+	return spec, nil
+}
+
+// Build creates the tree a Spec describes. source is used by random nodes.
+func Build(spec Spec, source RandomSource) (Node, error) {
+	switch spec.Type {
+	case "moveTo":
+		if spec.Target == "" {
+			return nil, fmt.Errorf("moveTo needs a target")
+		}
+		return MoveTo(spec.Target), nil
+	case "interact":
+		if spec.Action == "" {
+			return nil, fmt.Errorf("interact needs an action")
+		}
+		return Interact(spec.Action), nil
+	case "wait":
+		return Wait(spec.Frames), nil
+	case "succeed":
+		return Succeed(), nil
+	case "fail":
+		return Fail(), nil
+	case "sequence", "selector", "random":
+	default:
+		return nil, fmt.Errorf("unknown node type %q", spec.Type)
+	}
+
+	children := make([]Node, 0, len(spec.Children))
+	for i, childSpec := range spec.Children {
+		child, err := Build(childSpec, source)
+		if err != nil {
+			return nil, fmt.Errorf("%s child %d: %w", spec.Type, i, err)
+		}
+		children = append(children, child)
+	}
+
+	switch spec.Type {
+	case "sequence":
+		return Sequence(children...), nil
+	case "selector":
+		return Selector(children...), nil
+	}
+	if source == nil {
+		return nil, fmt.Errorf("random needs a random source")
+	}
+	choices := make([]Choice, len(children))
+	for i, child := range children {
+		weight := spec.Children[i].Weight
+		if weight == 0 {
+			weight = 1
+		}
+		choices[i] = Choice{Weight: weight, Node: child}
+	}
+	return Random(source, choices...), nil
+}
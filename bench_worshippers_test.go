@@ -0,0 +1,110 @@
+package main
+
+// Headless benchmarks of the worshipper simulation. They never open a window
+// or load an image, so they run without a display:
+//
+//	go test -run '^$' -bench . miko_game_with_worshippers.go worshippers_*.go
+
+import (
+	"encoding/json"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+const (
+	benchWorshippers = 5000 // New Year crowd the simulation has to keep up with
+	benchWarmupTicks = 600  // Ticks simulated before timing, so paths and lines are under way
+	benchSeed        = 1
+	benchTicksPerSec = 60 // Target tick rate
+)
+
+// newBenchGame creates a game without graphics, with the archetypes from the
+// data file and the crowd spread over the walkable tiles
+func newBenchGame(b *testing.B) *MikoGameWithWorshippers {
+	b.Helper()
+	data, err := os.ReadFile(archetypesFile)
+	if err != nil {
+		b.Fatal(err)
+	}
+	var file archetypeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		b.Fatal(err)
+	}
+	if err := linkGroups(file.Archetypes); err != nil {
+		b.Fatal(err)
+	}
+
+	shrineMap := createMikoShrineMap()
+	schedule := defaultSpawnSchedule()
+	schedule.MaxVisitors = benchWorshippers
+	g := &MikoGameWithWorshippers{
+		shrineMap:     shrineMap,
+		player:        &Player{X: 100, Y: 100},
+		archetypes:    file.Archetypes,
+		schedule:      schedule,
+		clock:         schedule.NewClock(),
+		seed:          benchSeed,
+		rng:           rand.New(rand.NewSource(benchSeed)),
+		cleanliness:   1,
+		reputation:    NewReputation(),
+		donationQueue: NewDonationQueue(shrineMap),
+		pathService:   NewPathService(defaultPathServiceWorker()),
+	}
+	g.addMapChangeListener(g.invalidateWorshipperPaths)
+	g.addMapChangeListener(g.rebuildQueueLine)
+
+	var walkable []Point
+	for y := range shrineMap {
+		for x := range shrineMap[y] {
+			if isWalkable(shrineMap, x, y) {
+				walkable = append(walkable, Point{x, y})
+			}
+		}
+	}
+	g.topUpCrowd(func(w *Worshipper) {
+		w.X, w.Y = tileToPixel(walkable[g.rng.Intn(len(walkable))])
+		w.X += g.rng.Float64()*32 - 16
+		w.Y += g.rng.Float64()*32 - 16
+	})
+	return g
+}
+
+// topUpCrowd spawns visitors until the crowd is benchWorshippers strong.
+// place, if given, moves each newcomer.
+func (g *MikoGameWithWorshippers) topUpCrowd(place func(w *Worshipper)) {
+	env := g.worshipperEnv()
+	for g.worshippers.Len() < benchWorshippers {
+		for _, w := range g.spawnVisitors(pickArchetype(g.rng, g.archetypes), env) {
+			if place != nil {
+				place(w)
+			}
+			g.worshippers.Add(w)
+		}
+	}
+}
+
+// BenchmarkUpdateWorshippers times one simulation tick with a New Year
+// crowd on the map. Visitors who leave are replaced, so the crowd stays at
+// benchWorshippers.
+func BenchmarkUpdateWorshippers(b *testing.B) {
+	g := newBenchGame(b)
+	for i := 0; i < benchWarmupTicks; i++ {
+		g.updateWorshippers()
+		g.topUpCrowd(nil)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		g.updateWorshippers()
+		g.topUpCrowd(nil)
+	}
+	b.StopTimer()
+
+	tps := float64(b.N) / b.Elapsed().Seconds()
+	b.ReportMetric(tps, "ticks/s")
+	if tps < benchTicksPerSec {
+		b.Logf("%.1f ticks/s with %d worshippers, below the target of %d", tps, g.worshippers.Len(), benchTicksPerSec)
+	}
+}
@@ -61,7 +61,7 @@ go mod download
 
 # WebAssemblyのビルド
 log_info "WebAssemblyファイルをビルド中..."
-go build -ldflags="-s -w" -o docs/game.wasm miko_game_with_worshippers.go
+go build -ldflags="-s -w" -o docs/game.wasm miko_game_with_worshippers.go worshippers_*.go
 
 if [ ! -f "docs/game.wasm" ]; then
     log_error "WebAssemblyファイルのビルドに失敗しました"
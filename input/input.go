@@ -0,0 +1,410 @@
+// Package input reads the player's controls through actions. A game names
+// its actions and binds each to keyboard keys, gamepad buttons and stick
+// directions, which a config file or the player can change; it then asks
+// whether an action is pressed rather than whether a key is.
+package input
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	StickDeadZone = 0.25 // Stick tilt below which the stick counts as centered
+	StickPressAt  = 0.6  // Stick tilt from which a stick direction counts as pressed
+
+	// PressedValue is the value a stick direction has when tilted to StickPressAt
+	PressedValue = (StickPressAt - StickDeadZone) / (1 - StickDeadZone)
+)
+
+// Action is something the player can do, whatever it is bound to. Each game
+// numbers its own actions from 0.
+type Action int
+
+// ActionInfo is how an action is named in the config file and on screen
+type ActionInfo struct {
+	ID    string
+	Label string
+}
+
+// BindingKind is the kind of control a binding reads
+type BindingKind int
+
+const (
+	BindKey    BindingKind = iota // A keyboard key
+	BindButton                    // A button of a gamepad in the standard layout
+	BindStick                     // One direction of a stick of a gamepad in the standard layout
+)
+
+// PadButtonNames name the standard gamepad buttons in the config file, after
+// an Xbox controller. Buttons without a name cannot be bound.
+var PadButtonNames = map[ebiten.StandardGamepadButton]string{
+	ebiten.StandardGamepadButtonRightBottom:      "A",
+	ebiten.StandardGamepadButtonRightRight:       "B",
+	ebiten.StandardGamepadButtonRightLeft:        "X",
+	ebiten.StandardGamepadButtonRightTop:         "Y",
+	ebiten.StandardGamepadButtonFrontTopLeft:     "LB",
+	ebiten.StandardGamepadButtonFrontTopRight:    "RB",
+	ebiten.StandardGamepadButtonFrontBottomLeft:  "LT",
+	ebiten.StandardGamepadButtonFrontBottomRight: "RT",
+	ebiten.StandardGamepadButtonCenterLeft:       "Back",
+	ebiten.StandardGamepadButtonCenterRight:      "Start",
+	ebiten.StandardGamepadButtonLeftStick:        "LS",
+	ebiten.StandardGamepadButtonRightStick:       "RS",
+	ebiten.StandardGamepadButtonLeftTop:          "DpadUp",
+	ebiten.StandardGamepadButtonLeftBottom:       "DpadDown",
+	ebiten.StandardGamepadButtonLeftLeft:         "DpadLeft",
+	ebiten.StandardGamepadButtonLeftRight:        "DpadRight",
+	ebiten.StandardGamepadButtonCenterCenter:     "Home",
+}
+
+// Stick is one direction of a stick
+type Stick struct {
+	Axis ebiten.StandardGamepadAxis
+	Sign float64 // -1 for left and up, 1 for right and down
+}
+
+// StickNames name the stick directions in the config file
+var StickNames = map[Stick]string{
+	{ebiten.StandardGamepadAxisLeftStickVertical, -1}:    "LeftUp",
+	{ebiten.StandardGamepadAxisLeftStickVertical, 1}:     "LeftDown",
+	{ebiten.StandardGamepadAxisLeftStickHorizontal, -1}:  "LeftLeft",
+	{ebiten.StandardGamepadAxisLeftStickHorizontal, 1}:   "LeftRight",
+	{ebiten.StandardGamepadAxisRightStickVertical, -1}:   "RightUp",
+	{ebiten.StandardGamepadAxisRightStickVertical, 1}:    "RightDown",
+	{ebiten.StandardGamepadAxisRightStickHorizontal, -1}: "RightLeft",
+	{ebiten.StandardGamepadAxisRightStickHorizontal, 1}:  "RightRight",
+}
+
+// keyLabels are shorter names for the keys whose names are long or unclear
+var keyLabels = map[ebiten.Key]string{
+	ebiten.KeyMinus:        "-",
+	ebiten.KeyEqual:        "=",
+	ebiten.KeyPeriod:       ".",
+	ebiten.KeyBracketLeft:  "[",
+	ebiten.KeyBracketRight: "]",
+	ebiten.KeyEscape:       "Esc",
+}
+
+// Binding is a key, gamepad button or stick direction bound to an action.
+// In the config file it is written "key:W", "pad:A" or "stick:LeftUp".
+type Binding struct {
+	Kind   BindingKind
+	Key    ebiten.Key
+	Button ebiten.StandardGamepadButton
+	Stick  Stick
+}
+
+// Key returns the binding of a keyboard key
+func Key(k ebiten.Key) Binding {
+	return Binding{Kind: BindKey, Key: k}
+}
+
+// Pad returns the binding of a gamepad button
+func Pad(b ebiten.StandardGamepadButton) Binding {
+	return Binding{Kind: BindButton, Button: b}
+}
+
+// StickDirection returns the binding of a stick direction
+func StickDirection(axis ebiten.StandardGamepadAxis, sign float64) Binding {
+	return Binding{Kind: BindStick, Stick: Stick{axis, sign}}
+}
+
+// String returns the binding as written in the config file
+func (b Binding) String() string {
+	switch b.Kind {
+	case BindButton:
+		return "pad:" + PadButtonNames[b.Button]
+	case BindStick:
+		return "stick:" + StickNames[b.Stick]
+	}
+	return "key:" + b.Key.String()
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (b Binding) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (b *Binding) UnmarshalText(text []byte) error {
+	kind, name, ok := strings.Cut(string(text), ":")
+	if !ok {
+		return fmt.Errorf("binding %q is not written device:name", text)
+	}
+	switch kind {
+	case "key":
+		b.Kind = BindKey
+		return b.Key.UnmarshalText([]byte(name))
+	case "pad":
+		for button, buttonName := range PadButtonNames {
+			if buttonName == name {
+				b.Kind, b.Button = BindButton, button
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown gamepad button %q", name)
+	case "stick":
+		for stick, stickName := range StickNames {
+			if stickName == name {
+				b.Kind, b.Stick = BindStick, stick
+				return nil
+			}
+		}
+		return fmt.Errorf("unknown stick direction %q", name)
+	}
+	return fmt.Errorf("unknown input device %q", kind)
+}
+
+// Label returns the binding as shown in the HUD
+func (b Binding) Label() string {
+	switch b.Kind {
+	case BindButton:
+		return "パッド" + PadButtonNames[b.Button]
+	case BindStick:
+		return "スティック" + StickNames[b.Stick]
+	}
+	if label, ok := keyLabels[b.Key]; ok {
+		return label
+	}
+	return strings.TrimPrefix(b.Key.String(), "Digit")
+}
+
+// Map reads the actions through their bindings. Actions are checked once per
+// frame in Update, so every action can tell whether it was just pressed,
+// whatever it is bound to.
+type Map struct {
+	Actions  []ActionInfo // Names of the actions, by Action
+	Defaults [][]Binding  // Bindings of the actions the config file leaves out
+	Bindings [][]Binding  // Bindings of each action
+	Disabled bool         // Every action reads as released, e.g. while a rebinding screen is open
+
+	pads    []ebiten.GamepadID
+	pressed []bool
+	was     []bool
+	touch   []float64 // Held down by on-screen touch controls, see SetTouch
+}
+
+// fileLayout is the layout of the config file: the bindings of each action
+// by its ID. Actions left out keep their default bindings.
+type fileLayout struct {
+	Bindings map[string][]Binding `json:"bindings"`
+}
+
+// NewMap returns a map of the actions with their default bindings
+func NewMap(actions []ActionInfo, defaults [][]Binding) Map {
+	m := Map{
+		Actions:  actions,
+		Defaults: defaults,
+		pressed:  make([]bool, len(actions)),
+		was:      make([]bool, len(actions)),
+		touch:    make([]float64, len(actions)),
+	}
+	m.Reset()
+	return m
+}
+
+// Reset brings back the default bindings
+func (m *Map) Reset() {
+	m.Bindings = make([][]Binding, len(m.Actions))
+	for action := range m.Bindings {
+		if action < len(m.Defaults) {
+			m.Bindings[action] = append([]Binding(nil), m.Defaults[action]...)
+		}
+	}
+}
+
+// actionByID looks up an action by its name in the config file
+func (m *Map) actionByID(id string) (Action, bool) {
+	for action, info := range m.Actions {
+		if info.ID == id {
+			return Action(action), true
+		}
+	}
+	return 0, false
+}
+
+// Load reads a config file over the default bindings. A binding may only
+// belong to one action, so no key does two things. On an error the default
+// bindings are kept.
+func (m *Map) Load(data []byte) error {
+	m.Reset()
+	var f fileLayout
+	if err := json.Unmarshal(data, &f); err != nil {
+		return err
+	}
+	for id, list := range f.Bindings {
+		action, ok := m.actionByID(id)
+		if !ok {
+			m.Reset()
+			return fmt.Errorf("unknown action %q", id)
+		}
+		m.Bindings[action] = list
+	}
+
+	owner := make(map[Binding]Action)
+	for action, list := range m.Bindings {
+		for _, b := range list {
+			if other, ok := owner[b]; ok && other != Action(action) {
+				m.Reset()
+				return fmt.Errorf("%s is bound to both %s and %s", b, m.Actions[other].ID, m.Actions[action].ID)
+			}
+			owner[b] = Action(action)
+		}
+	}
+	return nil
+}
+
+// LoadFile reads a config file from disk over the default bindings, see Load
+func (m *Map) LoadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return m.Load(data)
+}
+
+// Marshal returns the bindings as a config file, all of them, so later
+// changes to the defaults do not make two actions share a key
+func (m *Map) Marshal() ([]byte, error) {
+	f := fileLayout{Bindings: make(map[string][]Binding, len(m.Actions))}
+	for action, list := range m.Bindings {
+		f.Bindings[m.Actions[action].ID] = list
+	}
+	return json.MarshalIndent(f, "", "  ")
+}
+
+// Pads returns the connected gamepads in the standard layout, as of Update
+func (m *Map) Pads() []ebiten.GamepadID {
+	return m.pads
+}
+
+// BindingValue returns how far a binding is pressed, from 0 to 1. Any
+// connected gamepad in the standard layout counts.
+func (m *Map) BindingValue(b Binding) float64 {
+	switch b.Kind {
+	case BindKey:
+		if ebiten.IsKeyPressed(b.Key) {
+			return 1
+		}
+	case BindButton:
+		for _, id := range m.pads {
+			if ebiten.IsStandardGamepadButtonPressed(id, b.Button) {
+				return 1
+			}
+		}
+	case BindStick:
+		tilt := 0.0
+		for _, id := range m.pads {
+			tilt = math.Max(tilt, ebiten.StandardGamepadAxisValue(id, b.Stick.Axis)*b.Stick.Sign)
+		}
+		if tilt >= StickDeadZone {
+			return math.Min(1, (tilt-StickDeadZone)/(1-StickDeadZone))
+		}
+	}
+	return 0
+}
+
+// Value returns how far an action is pressed, from 0 to 1. Keys and buttons
+// are all or nothing, sticks in between.
+func (m *Map) Value(action Action) float64 {
+	if m.Disabled {
+		return 0
+	}
+	v := 0.0
+	for _, b := range m.Bindings[action] {
+		v = math.Max(v, m.BindingValue(b))
+	}
+	return math.Max(v, m.touch[action])
+}
+
+// Update reads the gamepads and the actions for this frame
+func (m *Map) Update() {
+	m.pads = m.pads[:0]
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		if ebiten.IsStandardGamepadLayoutAvailable(id) {
+			m.pads = append(m.pads, id)
+		}
+	}
+	copy(m.was, m.pressed)
+	for action := range m.pressed {
+		v := 0.0
+		for _, b := range m.Bindings[action] {
+			if b.Kind == BindStick {
+				// A stick direction counts as pressed when tilted well past the dead zone
+				if m.BindingValue(b) >= PressedValue {
+					v = 1
+				}
+				continue
+			}
+			v = math.Max(v, m.BindingValue(b))
+		}
+		// Touch controls press like a stick
+		if m.touch[action] >= PressedValue {
+			v = 1
+		}
+		m.pressed[action] = v > 0
+	}
+}
+
+// SetTouch sets how far on-screen touch controls hold each action down,
+// before Update reads the actions
+func (m *Map) SetTouch(values []float64) {
+	copy(m.touch, values)
+}
+
+// Pressed reports whether the action is held down
+func (m *Map) Pressed(action Action) bool {
+	return m.pressed[action] && !m.Disabled
+}
+
+// JustPressed reports whether the action was pressed this frame
+func (m *Map) JustPressed(action Action) bool {
+	return m.pressed[action] && !m.was[action] && !m.Disabled
+}
+
+// Label returns the first binding of the action as shown in the HUD, "-"
+// if it has none
+func (m *Map) Label(action Action) string {
+	if len(m.Bindings[action]) == 0 {
+		return "-"
+	}
+	return m.Bindings[action][0].Label()
+}
+
+// owner returns the action a binding belongs to
+func (m *Map) owner(b Binding) (Action, bool) {
+	for action, list := range m.Bindings {
+		for _, other := range list {
+			if other == b {
+				return Action(action), true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Bind adds a binding to the action, taking it away from the action that had
+// it. It returns that action, if there was one.
+func (m *Map) Bind(action Action, b Binding) (Action, bool) {
+	previous, taken := m.owner(b)
+	if taken {
+		if previous == action {
+			return previous, false
+		}
+		list := m.Bindings[previous]
+		for i, other := range list {
+			if other == b {
+				m.Bindings[previous] = append(list[:i:i], list[i+1:]...)
+				break
+			}
+		}
+	}
+	m.Bindings[action] = append(m.Bindings[action], b)
+	return previous, taken
+}
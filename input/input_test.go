@@ -0,0 +1,136 @@
+package input
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hajimehoshi/ebiten/v2"
+)
+
+const (
+	testUp Action = iota
+	testJump
+	testMenu
+)
+
+// testMap has three actions; the menu has no default bindings
+func testMap() Map {
+	return NewMap(
+		[]ActionInfo{
+			testUp:   {ID: "up", Label: "Up"},
+			testJump: {ID: "jump", Label: "Jump"},
+			testMenu: {ID: "menu", Label: "Menu"},
+		},
+		[][]Binding{
+			testUp:   {Key(ebiten.KeyW), StickDirection(ebiten.StandardGamepadAxisLeftStickVertical, -1)},
+			testJump: {Key(ebiten.KeySpace), Pad(ebiten.StandardGamepadButtonRightBottom)},
+		},
+	)
+}
+
+func TestBindingText(t *testing.T) {
+	for _, text := range []string{"key:W", "key:ArrowUp", "pad:A", "pad:DpadUp", "stick:LeftUp", "stick:RightRight"} {
+		var b Binding
+		if err := b.UnmarshalText([]byte(text)); err != nil {
+			t.Errorf("UnmarshalText(%q): %v", text, err)
+			continue
+		}
+		if b.String() != text {
+			t.Errorf("UnmarshalText(%q).String() = %q", text, b.String())
+		}
+	}
+	for _, text := range []string{"W", "key:NoSuchKey", "pad:Z", "stick:Sideways", "mouse:Left"} {
+		var b Binding
+		if err := b.UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) = %v, want an error", text, b)
+		}
+	}
+}
+
+func TestLoadKeepsDefaultsLeftOut(t *testing.T) {
+	m := testMap()
+	if err := m.Load([]byte(`{"bindings": {"jump": ["key:J"], "menu": ["pad:Start"]}}`)); err != nil {
+		t.Fatal(err)
+	}
+	want := [][]Binding{
+		testUp:   {Key(ebiten.KeyW), StickDirection(ebiten.StandardGamepadAxisLeftStickVertical, -1)},
+		testJump: {Key(ebiten.KeyJ)},
+		testMenu: {Pad(ebiten.StandardGamepadButtonCenterRight)},
+	}
+	if !reflect.DeepEqual(m.Bindings, want) {
+		t.Errorf("Bindings = %v, want %v", m.Bindings, want)
+	}
+}
+
+func TestLoadRejectsSharedBindings(t *testing.T) {
+	m := testMap()
+	err := m.Load([]byte(`{"bindings": {"menu": ["key:W"]}}`))
+	if err == nil || !strings.Contains(err.Error(), "both") {
+		t.Fatalf("Load = %v, want an error about a shared binding", err)
+	}
+	if !reflect.DeepEqual(m.Bindings, testMap().Bindings) {
+		t.Errorf("Bindings = %v after a failed load, want the defaults", m.Bindings)
+	}
+}
+
+func TestLoadRejectsUnknownActions(t *testing.T) {
+	m := testMap()
+	if err := m.Load([]byte(`{"bindings": {"fly": ["key:F"]}}`)); err == nil {
+		t.Fatal("Load accepted an unknown action")
+	}
+	if !reflect.DeepEqual(m.Bindings, testMap().Bindings) {
+		t.Errorf("Bindings = %v after a failed load, want the defaults", m.Bindings)
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	m := testMap()
+	m.Bind(testMenu, Key(ebiten.KeyEscape))
+	data, err := m.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded := testMap()
+	if err := loaded.Load(data); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.Bindings, m.Bindings) {
+		t.Errorf("Bindings = %v after a round trip, want %v", loaded.Bindings, m.Bindings)
+	}
+}
+
+func TestBindTakesBindingAway(t *testing.T) {
+	m := testMap()
+	previous, taken := m.Bind(testMenu, Key(ebiten.KeySpace))
+	if !taken || previous != testJump {
+		t.Fatalf("Bind = %v, %v, want it taken from jump", previous, taken)
+	}
+	if want := []Binding{Pad(ebiten.StandardGamepadButtonRightBottom)}; !reflect.DeepEqual(m.Bindings[testJump], want) {
+		t.Errorf("jump bindings = %v, want %v", m.Bindings[testJump], want)
+	}
+	if _, taken := m.Bind(testMenu, Key(ebiten.KeySpace)); taken {
+		t.Error("binding an action's own binding again took it from another action")
+	}
+	if len(m.Bindings[testMenu]) != 1 {
+		t.Errorf("menu bindings = %v, want Space once", m.Bindings[testMenu])
+	}
+
+	m.Reset()
+	if !reflect.DeepEqual(m.Bindings, testMap().Bindings) {
+		t.Errorf("Bindings = %v after Reset, want the defaults", m.Bindings)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	m := testMap()
+	if got := m.Label(testUp); got != "W" {
+		t.Errorf("Label(up) = %q, want W", got)
+	}
+	if got := m.Label(testMenu); got != "-" {
+		t.Errorf("Label(menu) = %q, want - for an unbound action", got)
+	}
+	if got := Key(ebiten.Key1).Label(); got != "1" {
+		t.Errorf("Key1 label = %q, want 1", got)
+	}
+}
@@ -8,19 +8,53 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+	"EdomaeElf/input"
 )
 
 const (
 	screenWidth  = 640
 	screenHeight = 480
+	bindingsFile = "assets/data/main_sprite_input.json" // Keys, gamepad buttons and sticks of the actions
+)
+
+// Actions the player can take, read through their bindings
+const (
+	actionMoveUp input.Action = iota
+	actionMoveDown
+	actionMoveLeft
+	actionMoveRight
 )
 
+// gameActions names the actions in the config file
+var gameActions = []input.ActionInfo{
+	actionMoveUp:    {ID: "moveUp", Label: "Move Up"},
+	actionMoveDown:  {ID: "moveDown", Label: "Move Down"},
+	actionMoveLeft:  {ID: "moveLeft", Label: "Move Left"},
+	actionMoveRight: {ID: "moveRight", Label: "Move Right"},
+}
+
+// defaultBindings are the bindings used for actions the config file leaves
+// out, and when there is no config file
+func defaultBindings() [][]input.Binding {
+	key, pad, stick := input.Key, input.Pad, input.StickDirection
+	vertical, horizontal := ebiten.StandardGamepadAxisLeftStickVertical, ebiten.StandardGamepadAxisLeftStickHorizontal
+
+	b := make([][]input.Binding, len(gameActions))
+	b[actionMoveUp] = []input.Binding{key(ebiten.KeyArrowUp), key(ebiten.KeyW), pad(ebiten.StandardGamepadButtonLeftTop), stick(vertical, -1)}
+	b[actionMoveDown] = []input.Binding{key(ebiten.KeyArrowDown), key(ebiten.KeyS), pad(ebiten.StandardGamepadButtonLeftBottom), stick(vertical, 1)}
+	b[actionMoveLeft] = []input.Binding{key(ebiten.KeyArrowLeft), key(ebiten.KeyA), pad(ebiten.StandardGamepadButtonLeftLeft), stick(horizontal, -1)}
+	b[actionMoveRight] = []input.Binding{key(ebiten.KeyArrowRight), key(ebiten.KeyD), pad(ebiten.StandardGamepadButtonLeftRight), stick(horizontal, 1)}
+	return b
+}
+
 // Game implements ebiten.Game interface
 type Game struct {
 	playerImage *ebiten.Image
 	playerX     float64
 	playerY     float64
 	time        float64
+	input       input.Map // Keys, gamepad buttons and sticks, read through the actions they are bound to
 }
 
 // NewGame creates a new game instance
@@ -28,6 +62,12 @@ func NewGame() *Game {
 	g := &Game{
 		playerX: screenWidth / 2,
 		playerY: screenHeight / 2,
+		input:   input.NewMap(gameActions, defaultBindings()),
+	}
+
+	// Load what the keys, gamepad buttons and sticks are bound to
+	if err := g.input.LoadFile(bindingsFile); err != nil {
+		log.Printf("Warning: Could not load bindings, using defaults: %v", err)
 	}
 	
 	// Create a simple sprite (a colored square for now)
@@ -51,20 +91,11 @@ func NewGame() *Game {
 func (g *Game) Update() error {
 	g.time += 0.02
 	
-	// Simple keyboard controls
+	// Simple controls, slower with a stick tilted a little
+	g.input.Update()
 	speed := 3.0
-	if ebiten.IsKeyPressed(ebiten.KeyLeft) || ebiten.IsKeyPressed(ebiten.KeyA) {
-		g.playerX -= speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyRight) || ebiten.IsKeyPressed(ebiten.KeyD) {
-		g.playerX += speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyUp) || ebiten.IsKeyPressed(ebiten.KeyW) {
-		g.playerY -= speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyDown) || ebiten.IsKeyPressed(ebiten.KeyS) {
-		g.playerY += speed
-	}
+	g.playerX += (g.input.Value(actionMoveRight) - g.input.Value(actionMoveLeft)) * speed
+	g.playerY += (g.input.Value(actionMoveDown) - g.input.Value(actionMoveUp)) * speed
 	
 	// Keep player on screen
 	g.playerX = math.Max(0, math.Min(g.playerX, float64(screenWidth-32)))
@@ -97,7 +128,8 @@ func (g *Game) Draw(screen *ebiten.Image) {
 	
 	// Draw UI
 	ebitenutil.DebugPrintAt(screen, "EdomaeElf - Sprite Example", 10, 10)
-	ebitenutil.DebugPrintAt(screen, "Use Arrow Keys or WASD to move", 10, 30)
+	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Use %s/%s/%s/%s to move",
+		g.input.Label(actionMoveUp), g.input.Label(actionMoveLeft), g.input.Label(actionMoveDown), g.input.Label(actionMoveRight)), 10, 30)
 	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("Position: (%.0f, %.0f)", g.playerX, g.playerY), 10, 50)
 	ebitenutil.DebugPrintAt(screen, fmt.Sprintf("FPS: %0.2f", ebiten.ActualFPS()), 10, 70)
 }
@@ -8,7 +8,8 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"EdomaeElf/input"
 )
 
 const (
@@ -16,13 +17,48 @@ const (
 	screenHeight = 600
 	tileSize     = 16
 	scaleFactor  = 3 // Scale tiles 3x for better visibility
+	bindingsFile = "assets/data/main_tilemap_input.json" // Keys, gamepad buttons and sticks of the actions
+)
+
+// Actions the player can take, read through their bindings
+const (
+	actionCameraUp input.Action = iota
+	actionCameraDown
+	actionCameraLeft
+	actionCameraRight
+	actionCameraReset // Move the camera back to the corner
 )
 
+// gameActions names the actions in the config file
+var gameActions = []input.ActionInfo{
+	actionCameraUp:    {ID: "cameraUp", Label: "Camera Up"},
+	actionCameraDown:  {ID: "cameraDown", Label: "Camera Down"},
+	actionCameraLeft:  {ID: "cameraLeft", Label: "Camera Left"},
+	actionCameraRight: {ID: "cameraRight", Label: "Camera Right"},
+	actionCameraReset: {ID: "cameraReset", Label: "Reset Camera"},
+}
+
+// defaultBindings are the bindings used for actions the config file leaves
+// out, and when there is no config file
+func defaultBindings() [][]input.Binding {
+	key, pad, stick := input.Key, input.Pad, input.StickDirection
+	vertical, horizontal := ebiten.StandardGamepadAxisLeftStickVertical, ebiten.StandardGamepadAxisLeftStickHorizontal
+
+	b := make([][]input.Binding, len(gameActions))
+	b[actionCameraUp] = []input.Binding{key(ebiten.KeyArrowUp), pad(ebiten.StandardGamepadButtonLeftTop), stick(vertical, -1)}
+	b[actionCameraDown] = []input.Binding{key(ebiten.KeyArrowDown), pad(ebiten.StandardGamepadButtonLeftBottom), stick(vertical, 1)}
+	b[actionCameraLeft] = []input.Binding{key(ebiten.KeyArrowLeft), pad(ebiten.StandardGamepadButtonLeftLeft), stick(horizontal, -1)}
+	b[actionCameraRight] = []input.Binding{key(ebiten.KeyArrowRight), pad(ebiten.StandardGamepadButtonLeftRight), stick(horizontal, 1)}
+	b[actionCameraReset] = []input.Binding{key(ebiten.KeySpace), pad(ebiten.StandardGamepadButtonRightTop)}
+	return b
+}
+
 type JapaneseTownGame struct {
 	tilemapImage *ebiten.Image
 	mapData      [][]int
 	cameraX      float64
 	cameraY      float64
+	input        input.Map // Keys, gamepad buttons and sticks, read through the actions they are bound to
 }
 
 func NewJapaneseTownGame() *JapaneseTownGame {
@@ -50,32 +86,31 @@ func NewJapaneseTownGame() *JapaneseTownGame {
 		{32, 34, 34, 34, 34, 34, 34, 34, 34, 34, 34, 34, 34, 34, 34, 34},
 	}
 
+	// Load what the keys, gamepad buttons and sticks are bound to
+	inputMap := input.NewMap(gameActions, defaultBindings())
+	if err := inputMap.LoadFile(bindingsFile); err != nil {
+		log.Printf("Warning: Could not load bindings, using defaults: %v", err)
+	}
+
 	return &JapaneseTownGame{
 		tilemapImage: img,
 		mapData:      mapData,
 		cameraX:      0,
 		cameraY:      0,
+		input:        inputMap,
 	}
 }
 
 func (g *JapaneseTownGame) Update() error {
-	// Camera movement with arrow keys
+	g.input.Update()
+
+	// Camera movement, slower with a stick tilted a little
 	speed := 5.0
-	if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
-		g.cameraX -= speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
-		g.cameraX += speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
-		g.cameraY -= speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
-		g.cameraY += speed
-	}
+	g.cameraX += (g.input.Value(actionCameraRight) - g.input.Value(actionCameraLeft)) * speed
+	g.cameraY += (g.input.Value(actionCameraDown) - g.input.Value(actionCameraUp)) * speed
 
-	// Reset camera with Space
-	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+	// Reset camera
+	if g.input.JustPressed(actionCameraReset) {
 		g.cameraX = 0
 		g.cameraY = 0
 	}
@@ -126,8 +161,10 @@ func (g *JapaneseTownGame) Draw(screen *ebiten.Image) {
 
 	// Display controls
 	controls := fmt.Sprintf(
-		"Japanese Town Demo\nFPS: %0.2f\nArrow Keys: Move Camera\nSpace: Reset Camera\nCamera: (%.0f, %.0f)",
-		ebiten.ActualFPS(), g.cameraX, g.cameraY,
+		"Japanese Town Demo\nFPS: %0.2f\n%s/%s/%s/%s: Move Camera\n%s: Reset Camera\nCamera: (%.0f, %.0f)",
+		ebiten.ActualFPS(),
+		g.input.Label(actionCameraUp), g.input.Label(actionCameraLeft), g.input.Label(actionCameraDown), g.input.Label(actionCameraRight),
+		g.input.Label(actionCameraReset), g.cameraX, g.cameraY,
 	)
 	ebitenutil.DebugPrint(screen, controls)
 }
@@ -10,7 +10,8 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"EdomaeElf/input"
 )
 
 const (
@@ -21,8 +22,57 @@ const (
 	mikoMapWidth      = 16
 	mikoMapHeight     = 12
 	playerSpeed       = 2.0
+	bindingsFile      = "assets/data/miko_game_input.json" // Keys, gamepad buttons and sticks of the actions
+)
+
+// Actions the player can take, read through their bindings
+const (
+	actionMoveUp input.Action = iota
+	actionMoveDown
+	actionMoveLeft
+	actionMoveRight
+	actionToggleEditor // Switch between walking and editing the map
+	actionCameraReset  // Move the editor's camera back to the corner
+	actionTilePrevX    // Pick the tile to place in the editor
+	actionTileNextX
+	actionTilePrevY
+	actionTileNextY
 )
 
+// gameActions names the actions in the config file
+var gameActions = []input.ActionInfo{
+	actionMoveUp:       {ID: "moveUp", Label: "上へ移動"},
+	actionMoveDown:     {ID: "moveDown", Label: "下へ移動"},
+	actionMoveLeft:     {ID: "moveLeft", Label: "左へ移動"},
+	actionMoveRight:    {ID: "moveRight", Label: "右へ移動"},
+	actionToggleEditor: {ID: "toggleEditor", Label: "編集モード切替"},
+	actionCameraReset:  {ID: "cameraReset", Label: "カメラリセット"},
+	actionTilePrevX:    {ID: "tilePrevX", Label: "タイルX-"},
+	actionTileNextX:    {ID: "tileNextX", Label: "タイルX+"},
+	actionTilePrevY:    {ID: "tilePrevY", Label: "タイルY-"},
+	actionTileNextY:    {ID: "tileNextY", Label: "タイルY+"},
+}
+
+// defaultBindings are the bindings used for actions the config file leaves
+// out, and when there is no config file
+func defaultBindings() [][]input.Binding {
+	key, pad, stick := input.Key, input.Pad, input.StickDirection
+	vertical, horizontal := ebiten.StandardGamepadAxisLeftStickVertical, ebiten.StandardGamepadAxisLeftStickHorizontal
+
+	b := make([][]input.Binding, len(gameActions))
+	b[actionMoveUp] = []input.Binding{key(ebiten.KeyW), key(ebiten.KeyArrowUp), pad(ebiten.StandardGamepadButtonLeftTop), stick(vertical, -1)}
+	b[actionMoveDown] = []input.Binding{key(ebiten.KeyS), key(ebiten.KeyArrowDown), pad(ebiten.StandardGamepadButtonLeftBottom), stick(vertical, 1)}
+	b[actionMoveLeft] = []input.Binding{key(ebiten.KeyA), key(ebiten.KeyArrowLeft), pad(ebiten.StandardGamepadButtonLeftLeft), stick(horizontal, -1)}
+	b[actionMoveRight] = []input.Binding{key(ebiten.KeyD), key(ebiten.KeyArrowRight), pad(ebiten.StandardGamepadButtonLeftRight), stick(horizontal, 1)}
+	b[actionToggleEditor] = []input.Binding{key(ebiten.KeyE), pad(ebiten.StandardGamepadButtonCenterLeft)}
+	b[actionCameraReset] = []input.Binding{key(ebiten.KeyHome), pad(ebiten.StandardGamepadButtonRightTop)}
+	b[actionTilePrevX] = []input.Binding{key(ebiten.KeyQ), pad(ebiten.StandardGamepadButtonFrontTopLeft)}
+	b[actionTileNextX] = []input.Binding{key(ebiten.KeyR), pad(ebiten.StandardGamepadButtonFrontTopRight)}
+	b[actionTilePrevY] = []input.Binding{key(ebiten.KeyT), pad(ebiten.StandardGamepadButtonFrontBottomLeft)}
+	b[actionTileNextY] = []input.Binding{key(ebiten.KeyY), pad(ebiten.StandardGamepadButtonFrontBottomRight)}
+	return b
+}
+
 // TileID represents a tile by its x,y position in the tileset
 type TileID struct {
 	X, Y int
@@ -48,6 +98,7 @@ type MikoGame struct {
 	cameraY        float64
 	editMode       bool
 	selectedTile   TileID
+	input          input.Map // Keys, gamepad buttons and sticks, read through the actions they are bound to
 }
 
 func NewMikoGame() *MikoGame {
@@ -84,6 +135,12 @@ func NewMikoGame() *MikoGame {
 		Image:  playerImg,
 	}
 
+	// Load what the keys, gamepad buttons and sticks are bound to
+	inputMap := input.NewMap(gameActions, defaultBindings())
+	if err := inputMap.LoadFile(bindingsFile); err != nil {
+		log.Printf("Warning: Could not load bindings, using defaults: %v", err)
+	}
+
 	// Create the shrine map
 	shrineMap := createMikoShrineMap()
 
@@ -96,6 +153,7 @@ func NewMikoGame() *MikoGame {
 		cameraY:      0,
 		editMode:     false,
 		selectedTile: TileID{0, 0},
+		input:        inputMap,
 	}
 }
 
@@ -191,25 +249,17 @@ func createMikoShrineMap() [][]TileID {
 }
 
 func (g *MikoGame) Update() error {
+	g.input.Update()
+
 	// Toggle edit mode
-	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+	if g.input.JustPressed(actionToggleEditor) {
 		g.editMode = !g.editMode
 	}
 
 	if !g.editMode {
-		// Player movement with WASD
-		if ebiten.IsKeyPressed(ebiten.KeyW) || ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
-			g.player.Y -= playerSpeed
-		}
-		if ebiten.IsKeyPressed(ebiten.KeyS) || ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
-			g.player.Y += playerSpeed
-		}
-		if ebiten.IsKeyPressed(ebiten.KeyA) || ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
-			g.player.X -= playerSpeed
-		}
-		if ebiten.IsKeyPressed(ebiten.KeyD) || ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
-			g.player.X += playerSpeed
-		}
+		// Player movement, slower with a stick tilted a little
+		g.player.Y += (g.input.Value(actionMoveDown) - g.input.Value(actionMoveUp)) * playerSpeed
+		g.player.X += (g.input.Value(actionMoveRight) - g.input.Value(actionMoveLeft)) * playerSpeed
 
 		// Keep player within map bounds
 		mapWidthPixels := float64(mikoMapWidth) * mikoTileSize * mikoScaleFactor
@@ -251,25 +301,25 @@ func (g *MikoGame) Update() error {
 	} else {
 		// Edit mode controls
 		// Tile selection
-		if inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+		if g.input.JustPressed(actionTilePrevX) {
 			g.selectedTile.X--
 			if g.selectedTile.X < 0 {
 				g.selectedTile.X = 7
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		if g.input.JustPressed(actionTileNextX) {
 			g.selectedTile.X++
 			if g.selectedTile.X > 7 {
 				g.selectedTile.X = 0
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		if g.input.JustPressed(actionTilePrevY) {
 			g.selectedTile.Y--
 			if g.selectedTile.Y < 0 {
 				g.selectedTile.Y = 7
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+		if g.input.JustPressed(actionTileNextY) {
 			g.selectedTile.Y++
 			if g.selectedTile.Y > 7 {
 				g.selectedTile.Y = 0
@@ -289,8 +339,8 @@ func (g *MikoGame) Update() error {
 		}
 	}
 
-	// Reset camera with Space (only in edit mode)
-	if g.editMode && inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+	// Reset camera (only in edit mode)
+	if g.editMode && g.input.JustPressed(actionCameraReset) {
 		g.cameraX = 0
 		g.cameraY = 0
 	}
@@ -347,10 +397,12 @@ func (g *MikoGame) Draw(screen *ebiten.Image) {
 		tileKey := fmt.Sprintf("%d,%d", g.selectedTile.X, g.selectedTile.Y)
 		tileDesc := g.tileDesc[tileKey]
 		info += fmt.Sprintf("\n[編集モード]\n選択タイル: %s\n%s\n", tileKey, tileDesc)
-		info += "Q/R: タイルX選択, T/Y: タイルY選択\n左クリック: タイル配置\nSpace: カメラリセット"
+		info += fmt.Sprintf("%s/%s: タイルX選択, %s/%s: タイルY選択\n左クリック: タイル配置\n%s: カメラリセット",
+			g.input.Label(actionTilePrevX), g.input.Label(actionTileNextX), g.input.Label(actionTilePrevY), g.input.Label(actionTileNextY), g.input.Label(actionCameraReset))
 	} else {
 		info += fmt.Sprintf("\nプレイヤー位置: (%.0f, %.0f)\n", g.player.X, g.player.Y)
-		info += "WASD/矢印キー: 移動\nE: 編集モード切替"
+		info += fmt.Sprintf("%s/%s/%s/%s: 移動\n%s: 編集モード切替",
+			g.input.Label(actionMoveUp), g.input.Label(actionMoveLeft), g.input.Label(actionMoveDown), g.input.Label(actionMoveRight), g.input.Label(actionToggleEditor))
 	}
 	
 	ebitenutil.DebugPrint(screen, info)
@@ -1,18 +1,24 @@
 package main
 
 import (
+	"cmp"
 	"container/heap"
+	"flag"
 	"fmt"
 	"image"
 	"image/color"
 	"log"
 	"math"
 	"math/rand"
+	"slices"
 	"time"
 
+	"EdomaeElf/anim"
+	"EdomaeElf/behavior"
+	"EdomaeElf/input"
+
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
 
 const (
@@ -24,7 +30,6 @@ const (
 	mikoMapHeight    = 12
 	playerSpeed      = 2.0
 	worshipperSpeed  = 1.0
-	spawnInterval    = 300 // frames between spawns (5 seconds at 60fps)
 	offeringDuration = 120 // frames to stay at donation box (2 seconds)
 
 	// Pathfinding constants
@@ -33,6 +38,9 @@ const (
 	maxSearchRadius               = 5
 	pathfindingProximityThreshold = 10.0
 
+	// Sprite scales used when drawing characters
+	playerSpriteScale     = 0.125
+	worshipperSpriteScale = 0.1 // Smaller than player
 )
 
 // TileID represents a tile by its x,y position in the tileset
@@ -91,9 +99,20 @@ var walkableTilesMap = map[TileID]bool{
 
 type Player struct {
 	X, Y   float64
-	Width  float64
-	Height float64
-	Image  *ebiten.Image
+	VX, VY float64       // Movement during the last frame
+	Image  *ebiten.Image // First cell of the sprite, sets the drawn size and the hitbox
+	Sprite *Sprite       // Sheet the miko is drawn from
+	Anim   anim.Animator // Clip being played
+	Facing Facing        // Way she looks, for the tile in front of her
+	Inside bool          // In the haiden, out of sight and not moving
+}
+
+// spriteSize returns the drawn edge length of a square sprite at the given scale
+func spriteSize(img *ebiten.Image, scale float64) float64 {
+	if img == nil {
+		return 0
+	}
+	return float64(img.Bounds().Dx()) * scale
 }
 
 // isWalkable checks if a tile at the given coordinates is walkable
@@ -118,6 +137,20 @@ func manhattanDistance(a, b Point) float64 {
 
 // findPath uses A* algorithm to find a path from start to goal
 func findPath(shrineMap [][]TileID, start, goal Point) ([]Point, error) {
+	if debugPathTrace == nil {
+		return findPathTraced(shrineMap, start, goal, nil)
+	}
+
+	// Record the search for the debug overlay
+	debugPathTrace.reset(start, goal)
+	path, err := findPathTraced(shrineMap, start, goal, debugPathTrace)
+	debugPathTrace.Path = path
+	debugPathTrace.Err = err
+	return path, err
+}
+
+// findPathTraced is findPath that optionally records every expanded node into trace
+func findPathTraced(shrineMap [][]TileID, start, goal Point, trace *PathSearchTrace) ([]Point, error) {
 	// Validate input coordinates
 	if !isValidPosition(start) {
 		return nil, fmt.Errorf("invalid start position: (%d, %d)", start.X, start.Y)
@@ -162,6 +195,9 @@ func findPath(shrineMap [][]TileID, start, goal Point) ([]Point, error) {
 
 		// Add current node to closed list
 		closedList[current.Point] = current
+		if trace != nil {
+			trace.Steps = append(trace.Steps, PathSearchStep{Expanded: current.Point})
+		}
 
 		// Check if we've reached the goal
 		if current.Point.X == goal.X && current.Point.Y == goal.Y {
@@ -210,6 +246,9 @@ func findPath(shrineMap [][]TileID, start, goal Point) ([]Point, error) {
 						node.F = f
 						node.Parent = current
 						heap.Fix(openList, 0) // Re-heapify since we modified a node
+						if trace != nil {
+							trace.addOpened(neighborPoint)
+						}
 					}
 					found = true
 					break
@@ -226,6 +265,9 @@ func findPath(shrineMap [][]TileID, start, goal Point) ([]Point, error) {
 					F:      f,
 				}
 				heap.Push(openList, neighborNode)
+				if trace != nil {
+					trace.addOpened(neighborPoint)
+				}
 			}
 		}
 	}
@@ -238,13 +280,16 @@ func findPath(shrineMap [][]TileID, start, goal Point) ([]Point, error) {
 type WorshipperState int
 
 const (
-	StateApproaching WorshipperState = iota
-	StateOffering
-	StateLeaving
+	StateWalking  WorshipperState = iota // Walking to the current stop of the itinerary
+	StateQueueing                        // Waiting in line for a praying slot
+	StateVisiting                        // Performing the action of the current stop
+	StateLeaving                         // Itinerary done, heading home
+	StateConfused                        // No route to the goal, waiting for the map to change
 )
 
 // Worshipper represents a shrine visitor
 type Worshipper struct {
+	ID            int
 	X, Y          float64
 	Width, Height float64
 	Image         *ebiten.Image
@@ -257,6 +302,70 @@ type Worshipper struct {
 	Path          []Point    // Path to follow
 	PathIndex     int        // Current position in path
 	NextTarget    Point      // Next tile to move to
+	PrefVX        float64    // Desired velocity from path following
+	PrefVY        float64
+	VX, VY        float64         // Actual velocity after local steering
+	Slot          int             // Praying slot at the donation box, -1 if none
+	QueueIndex    int             // Place in the waiting line, -1 if not queueing
+	QueueTimer    int             // Frames spent waiting in line
+	Praying       bool            // Standing in the slot and praying
+	Goal          Point           // Destination tile of the current path
+	PathInvalid   bool            // The map changed and the path must be recomputed
+	ResumeState   WorshipperState // State to return to once a confused worshipper finds a route
+	ConfusedTimer int             // Frames spent confused
+	Archetype     *Archetype      // Kind of visitor
+	Scale         float64         // Sprite scale
+	Patience      int             // Frames waited in line before giving up, 0 waits forever
+	Donation      int             // Yen offered at the donation box
+	GaveUp        bool            // Left the line without praying
+	Mood          float64         // From 0 (furious) to 1 (delighted), see worshippers_mood.go
+	Crowd         int             // Other visitors around at the last count, see updateMoods
+	Greeted       bool            // The miko has said hello
+	Helped        bool            // The miko has shown the way
+	OfferedCharm  bool            // The miko has offered an omamori
+	CutIn         bool            // Pushed in at the head of the line and has not been told off
+	LeftEarly     bool            // Cut the visit short in a bad mood
+	Arrived       bool            // Has walked onto the map
+	SawBlossoms   bool            // Has passed close to a cherry tree
+	Prayed        bool            // Has prayed at the donation box
+	Group         *VisitGroup     // Party the worshipper came with, nil if alone
+	Regular       *RegularVisitor // Entry in the visitor book, nil for a visitor the shrine does not know
+	Following     bool            // Walking behind the group leader rather than along a path
+	Reached       string          // Last target reached, which group members wait on each other for
+	GroupWait     int             // Frames spent waiting for the group at Reached
+	Itinerary     []VisitStop     // Stops of the visit, in the order the behavior first heads to them
+	Stop          *VisitStop      // Stop the worshipper is heading to or visiting, nil if none
+	Behavior      behavior.Node   // What the worshipper does, built from the itinerary
+	Sprite        *Sprite         // Sheet the worshipper is drawn from, nil in headless runs
+	Anim          anim.Animator   // Clip being played
+
+	PathStartTick    int             // Tick at which the path starts, see PathResult
+	PathScheduled    bool            // The path is reserved and must be walked on schedule
+	PendingPath      int             // ID of the path request being waited for, 0 if none
+	IdleWhilePending bool            // Stand still instead of heading straight for the goal
+	pathResults      chan PathResult // Answers from the path service
+
+	agent worshipperAgent // Passed to Behavior, reused every frame
+}
+
+// WorshipperEnv is the part of the game a worshipper needs to update
+type WorshipperEnv struct {
+	ShrineMap [][]TileID
+	Queue     *DonationQueue
+	Paths     *PathService
+	Tick      int
+	Rand      *rand.Rand      // Simulation random numbers, seeded for replays
+	Pool      *WorshipperPool // Worshippers on the map, whose leavers new visitors reuse
+	Chores    *Chores         // Shrine chores, for the water left in the temizuya
+}
+
+// setPreferredVelocity requests movement along (dx, dy) at the worshipper's speed.
+// The steering layer turns this into actual movement.
+func (w *Worshipper) setPreferredVelocity(dx, dy, distance float64) {
+	if distance > 0 {
+		w.PrefVX = (dx / distance) * w.Speed
+		w.PrefVY = (dy / distance) * w.Speed
+	}
 }
 
 // pixelToTile converts pixel coordinates to tile coordinates
@@ -307,13 +416,15 @@ func findNearestWalkableTile(shrineMap [][]TileID, x, y float64) (Point, error)
 	return Point{}, fmt.Errorf("no walkable tile found near position (%.2f, %.2f)", x, y)
 }
 
-// NewWorshipper creates a new worshipper at a random spawn position
-func NewWorshipper(image *ebiten.Image, shrineMap [][]TileID) *Worshipper {
+// NewWorshipper creates a new worshipper of the given archetype at a random
+// spawn position, plans its visit and requests the path to the first stop
+func NewWorshipper(id int, archetype *Archetype, env *WorshipperEnv) *Worshipper {
 	// Spawn from random side of screen
 	var startX, startY float64
 	var targetX float64
 
-	side := rand.Intn(2) // 0 = left, 1 = right
+	rng := env.Rand
+	side := rng.Intn(2) // 0 = left, 1 = right
 	if side == 0 {
 		// Spawn from left
 		startX = -50
@@ -326,180 +437,91 @@ func NewWorshipper(image *ebiten.Image, shrineMap [][]TileID) *Worshipper {
 
 	startY = float64(mikoMapHeight-1) * mikoTileSize * mikoScaleFactor // Bottom of screen
 
-	// Random color tint for variety
-	colors := []color.RGBA{
-		{255, 255, 255, 255}, // White (no tint)
-		{255, 200, 200, 255}, // Light red
-		{200, 255, 200, 255}, // Light green
-		{200, 200, 255, 255}, // Light blue
-		{255, 255, 200, 255}, // Light yellow
-	}
-
-	worshipper := &Worshipper{
-		X:         startX,
-		Y:         startY,
-		Width:     32,
-		Height:    32,
-		Image:     image,
-		State:     StateApproaching,
-		Timer:     0,
-		StartX:    startX,
-		TargetX:   targetX,
-		Speed:     worshipperSpeed + rand.Float64()*0.5, // Random speed variation
-		Color:     colors[rand.Intn(len(colors))],
-		Path:      []Point{},
-		PathIndex: 0,
-	}
-
-	// Find nearest walkable tile to starting position
-	startTile, err := findNearestWalkableTile(shrineMap, startX, startY)
-	if err != nil {
-		// Log error but continue with fallback behavior
-		log.Printf("Warning: Could not find walkable starting tile: %v", err)
-		startTile = Point{mikoMapWidth / 2, mikoMapHeight - 1}
-	}
-
-	// Donation box is at predefined position
-	donationBoxTile := Point{donationBoxX, donationBoxY}
-
-	// Calculate path to donation box
-	path, err := findPath(shrineMap, startTile, donationBoxTile)
-	if err != nil {
-		// Log error but continue with empty path (fallback behavior)
-		log.Printf("Warning: Could not find path to donation box: %v", err)
-		path = []Point{}
+	// Take over the buffers of a visitor who has left
+	worshipper := env.Pool.recycled()
+	*worshipper = Worshipper{
+		ID:         id,
+		X:          startX,
+		Y:          startY,
+		Width:      32,
+		Height:     32,
+		Image:      archetype.image,
+		Sprite:     archetype.sprite,
+		Timer:      0,
+		StartX:     startX,
+		TargetX:    targetX,
+		Speed:      archetype.Speed.Draw(rng),
+		Color:      archetype.pickTint(rng),
+		Path:       worshipper.Path[:0],
+		PathIndex:  0,
+		Slot:       -1,
+		QueueIndex: -1,
+		Archetype:  archetype,
+		Scale:      archetype.Scale,
+		Patience:   archetype.Patience,
+		Donation:   archetype.Donation.Draw(rng),
+		Mood:       moodStart,
+
+		pathResults: worshipper.pathResults,
 	}
 
-	if len(path) > 0 {
-		worshipper.Path = path
-		worshipper.PathIndex = 0
-		worshipper.NextTarget = path[0]
-	}
+	// Plan the visit. The behavior asks for the path to the first stop on its
+	// first update, and the worshipper walks towards it in a straight line
+	// until the path arrives.
+	worshipper.planVisit(env, true)
 
 	return worshipper
 }
 
-// Update updates the worshipper's state and position
-func (w *Worshipper) Update(shrineMap [][]TileID) {
-	switch w.State {
-	case StateApproaching:
-		// Follow the path to the donation box
-		if len(w.Path) > 0 && w.PathIndex < len(w.Path) {
-			targetX, targetY := tileToPixel(w.NextTarget)
-
-			// Calculate direction to next path point
-			dx := targetX - w.X
-			dy := targetY - w.Y
-			distance := math.Sqrt(dx*dx + dy*dy)
-
-			// If close enough to current target, move to next path point
-			if distance < pathfindingProximityThreshold {
-				w.PathIndex++
-				if w.PathIndex < len(w.Path) {
-					w.NextTarget = w.Path[w.PathIndex]
-				} else {
-					// Reached destination
-					w.State = StateOffering
-					w.Timer = 0
-					return
-				}
-			} else {
-				// Move towards current target
-				if distance > 0 {
-					w.X += (dx / distance) * w.Speed
-					w.Y += (dy / distance) * w.Speed
-				}
-			}
-		} else {
-			// Fallback to direct movement if no path
-			donationBoxPixelX := float64(donationBoxX) * mikoTileSize * mikoScaleFactor
-			donationBoxPixelY := float64(donationBoxY) * mikoTileSize * mikoScaleFactor
-
-			dx := donationBoxPixelX - w.X
-			dy := donationBoxPixelY - w.Y
-			distance := math.Sqrt(dx*dx + dy*dy)
-
-			if distance < 20 {
-				w.State = StateOffering
-				w.Timer = 0
-				return
-			}
-
-			if distance > 0 {
-				w.X += (dx / distance) * w.Speed
-				w.Y += (dy / distance) * w.Speed
-			}
-		}
+// followPath moves the worshipper along its path and reports whether the end was reached
+func (w *Worshipper) followPath(tick int) bool {
+	if w.PathIndex >= len(w.Path) {
+		return true
+	}
 
-	case StateOffering:
-		// Stay at donation box for a while
-		w.Timer++
-		if w.Timer >= offeringDuration {
-			w.State = StateLeaving
-			w.Timer = 0
-
-			// Calculate path to exit
-			currentTile := pixelToTile(w.X, w.Y)
-			exitTile, err := findNearestWalkableTile(shrineMap, w.TargetX, float64(mikoMapHeight-1)*mikoTileSize*mikoScaleFactor)
-			if err != nil {
-				// Log error but continue with fallback behavior
-				log.Printf("Warning: Could not find walkable exit tile: %v", err)
-				exitTile = Point{mikoMapWidth / 2, mikoMapHeight - 1}
-			}
+	targetX, targetY := tileToPixel(w.NextTarget)
 
-			exitPath, err := findPath(shrineMap, currentTile, exitTile)
-			if err != nil {
-				// Log error but continue with empty path (fallback behavior)
-				log.Printf("Warning: Could not find path to exit: %v", err)
-				exitPath = []Point{}
-			}
+	// Calculate direction to next path point
+	dx := targetX - w.X
+	dy := targetY - w.Y
+	distance := math.Sqrt(dx*dx + dy*dy)
 
-			if len(exitPath) > 0 {
-				w.Path = exitPath
-				w.PathIndex = 0
-				w.NextTarget = exitPath[0]
-			}
+	// If close enough to current target, move to next path point. When other
+	// worshippers crowd the waypoint, standing on its tile is close enough.
+	reached := distance < pathfindingProximityThreshold
+	if !reached && w.PathIndex+1 < len(w.Path) {
+		reached = pixelToTile(w.X, w.Y) == w.NextTarget
+	}
+	if reached {
+		// Reserved paths must not run ahead of schedule, or the worshipper
+		// would step onto tiles others still hold. A repeated waypoint is a wait.
+		if w.PathScheduled && w.PathIndex+1 < len(w.Path) &&
+			tick < w.PathStartTick+w.PathIndex*reservationStepFrames {
+			return false
 		}
 
-	case StateLeaving:
-		// Follow the path to the exit
-		if len(w.Path) > 0 && w.PathIndex < len(w.Path) {
-			targetX, targetY := tileToPixel(w.NextTarget)
-
-			// Calculate direction to next path point
-			dx := targetX - w.X
-			dy := targetY - w.Y
-			distance := math.Sqrt(dx*dx + dy*dy)
-
-			// If close enough to current target, move to next path point
-			if distance < pathfindingProximityThreshold {
-				w.PathIndex++
-				if w.PathIndex < len(w.Path) {
-					w.NextTarget = w.Path[w.PathIndex]
-				} else {
-					// Reached exit path, now move off-screen
-					w.Path = []Point{}
-				}
-			} else {
-				// Move towards current target
-				if distance > 0 {
-					w.X += (dx / distance) * w.Speed
-					w.Y += (dy / distance) * w.Speed
-				}
-			}
-		} else {
-			// Move off-screen after following path
-			dx := w.TargetX - w.X
-			dy := (float64(mikoMapHeight) * mikoTileSize * mikoScaleFactor) - w.Y
+		w.PathIndex++
+		if w.PathIndex >= len(w.Path) {
+			return true
+		}
+		w.NextTarget = w.Path[w.PathIndex]
+		return false
+	}
 
-			distance := math.Sqrt(dx*dx + dy*dy)
+	// Move towards current target
+	w.setPreferredVelocity(dx, dy, distance)
+	return false
+}
 
-			if distance > 0 {
-				w.X += (dx / distance) * w.Speed
-				w.Y += (dy / distance) * w.Speed
-			}
-		}
+// Update runs the worshipper's behavior for a frame, which sets its state
+// and preferred velocity
+func (w *Worshipper) Update(env *WorshipperEnv) {
+	w.PrefVX, w.PrefVY = 0, 0
+	if w.Group != nil && w.Group.Leader() == w {
+		w.Group.recordTrail(w.X, w.Y)
 	}
+	w.agent = worshipperAgent{w: w, env: env}
+	w.Behavior.Tick(&w.agent)
 }
 
 // IsOffScreen checks if worshipper is off screen and should be removed
@@ -508,23 +530,82 @@ func (w *Worshipper) IsOffScreen() bool {
 }
 
 type MikoGameWithWorshippers struct {
-	tilemapImage    *ebiten.Image
-	shrineMap       [][]TileID
-	player          *Player
-	cameraX         float64
-	cameraY         float64
-	editMode        bool
-	selectedTile    TileID
-	worshippers     []*Worshipper
-	spawnTimer      int
-	worshipperImage *ebiten.Image
-	donationCount   int
-	totalDonations  int
-}
-
-func NewMikoGameWithWorshippers() *MikoGameWithWorshippers {
-	// Initialize random seed
-	rand.Seed(time.Now().UnixNano())
+	tilemapImage     *ebiten.Image
+	shrineMap        [][]TileID
+	player           *Player
+	route            *PlayerRoute // Walk the miko takes after a click or tap, nil if none
+	input            input.Map    // Keys, gamepad buttons and sticks, read through the actions they are bound to
+	rebind           RebindScreen
+	touch            TouchControls // On-screen joystick and buttons, and pinch zoom, once the screen is touched
+	cameraX          float64
+	cameraY          float64
+	editMode         bool
+	selectedTile     TileID
+	worshippers      WorshipperPool
+	worshipperImage  *ebiten.Image
+	ledger           Ledger          // Every offering made at the donation box
+	boxCollected     int             // Ledger entries the miko has collected from the donation box
+	suzuRungAt       time.Time       // In-game time she last rang the bell at the sacred tree
+	regulars         VisitorRegistry // Visitors who come back
+	visitorBook      VisitorBook
+	gaveUpCount      int // Visitors who left the line without praying
+	leftEarlyCount   int // Visitors who cut their visit short in a bad mood
+	cleanliness      float64
+	chores           Chores // Sweeping, lanterns, the temizuya and the amulet stall
+	reputation       Reputation
+	speech           Speech
+	interaction      InteractionMenu
+	charmsSold       int    // Omamori the miko sold
+	charmYen         int    // Yen taken for omamori
+	notice           string // Message shown in the HUD, see notify
+	noticeFrames     int
+	archetypes       []*Archetype
+	schedule         *SpawnSchedule
+	clock            GameClock
+	speedIndex       int // Index into gameSpeeds
+	seed             int64
+	rng              *rand.Rand // Every random decision of the simulation draws from this
+	playerRng        *rand.Rand // Rolls the player sets off, kept apart so they leave the simulation's draws alone
+	saveData         *SaveData
+	replay           bool // Replaying the last session, which leaves the save alone
+	framesSinceSave  int
+	donationQueue    *DonationQueue
+	pathService      *PathService
+	tick             int // Simulation ticks since the start
+	nextWorshipperID int
+
+	mapChangeListeners []MapChangeListener
+
+	// Pathfinding debug overlay
+	pathDebug PathDebugOverlay
+
+	// Local steering state, reused between frames
+	steeringGrid   *SpatialGrid
+	steeringAgents []steeringAgent
+	foundBuffer    []Neighbor
+	neighborBuffer []int
+
+	// Drawing state, reused between frames
+	spriteBatch   SpriteBatch
+	visibleBuffer []*Worshipper
+}
+
+func NewMikoGameWithWorshippers(options GameOptions) *MikoGameWithWorshippers {
+	// The simulation draws from its own seeded source so sessions can be replayed
+	saveData, err := loadSave()
+	if err != nil {
+		log.Printf("Warning: Could not load save, starting fresh: %v", err)
+		saveData = &SaveData{Version: saveVersion}
+	}
+	seed := chooseSeed(options, saveData)
+	replay := isReplay(options, saveData)
+	startClock, lastVisitorID := chooseStart(options, saveData)
+	ledger := NewLedger(saveData.LedgerDays, saveData.Ledger)
+	regulars, boxCollected := saveData.Regulars, saveData.BoxCollected
+	if replay {
+		ledger, regulars = NewLedger(saveData.LedgerDays, replayLedger(saveData)), saveData.StartRegulars
+		boxCollected = replayBoxCollected(saveData, &ledger)
+	}
 
 	// Load the tilemap image
 	tilemapImg, _, err := ebitenutil.NewImageFromFile("assets/tilemap/japanese_town_tileset.png")
@@ -542,19 +623,60 @@ func NewMikoGameWithWorshippers() *MikoGameWithWorshippers {
 
 	// Note: Tile descriptions are not loaded to ensure WebGL compatibility
 
+	// Load the sprite sheets, drawing characters without them unanimated
+	images := map[string]*ebiten.Image{"assets/characters/miko_girl.png": playerImg}
+	sprites, err := loadSprites(animationsFile, images)
+	if err != nil {
+		log.Printf("Warning: Could not load animations, characters stand still: %v", err)
+	}
+
 	// Create player
+	playerSprite := spriteFor(sprites, playerImg)
 	player := &Player{
 		X:      float64(mikoMapWidth/2) * mikoTileSize * mikoScaleFactor,
 		Y:      float64(mikoMapHeight/2) * mikoTileSize * mikoScaleFactor,
-		Width:  32,
-		Height: 32,
-		Image:  playerImg,
+		Image:  playerSprite.Cell(),
+		Sprite: playerSprite,
+	}
+
+	// Load the kinds of visitors, falling back to a single generic visitor
+	archetypes, err := loadArchetypes(archetypesFile, images, playerImg)
+	if err != nil {
+		log.Printf("Warning: Could not load visitor archetypes, using defaults: %v", err)
+		archetypes = defaultArchetypes(playerImg)
+	}
+	for _, a := range archetypes {
+		a.sprite = spriteFor(sprites, a.image)
+		a.image = a.sprite.Cell()
+	}
+
+	// Load the calendar and the spawn curves
+	schedule, err := loadSpawnSchedule(scheduleFile)
+	if err != nil {
+		log.Printf("Warning: Could not load spawn schedule, using defaults: %v", err)
+		schedule = defaultSpawnSchedule()
+	}
+
+	// Load what worshippers say, in the chosen language
+	language := options.Language
+	if language == "" {
+		language = defaultLanguage
+	}
+	lines, err := loadSpeechLines(language)
+	if err != nil {
+		log.Printf("Warning: Could not load speech lines, worshippers stay silent: %v", err)
+	}
+
+	// Load what the keys, gamepad buttons and sticks are bound to
+	inputMap := input.NewMap(inputActions, defaultBindings())
+	if err := loadBindings(&inputMap); err != nil {
+		log.Printf("Warning: Could not load bindings, using defaults: %v", err)
 	}
 
 	// Create the shrine map
 	shrineMap := createMikoShrineMap()
 
-	return &MikoGameWithWorshippers{
+	g := &MikoGameWithWorshippers{
 		tilemapImage:    tilemapImg,
 		shrineMap:       shrineMap,
 		player:          player,
@@ -562,12 +684,54 @@ func NewMikoGameWithWorshippers() *MikoGameWithWorshippers {
 		cameraY:         0,
 		editMode:        false,
 		selectedTile:    TileID{0, 0},
-		worshippers:     make([]*Worshipper, 0),
-		spawnTimer:      0,
+		input:           inputMap,
+		touch:           TouchControls{Zoom: touchZoomMin},
 		worshipperImage: playerImg, // Use same image as player for now
-		donationCount:   0,
-		totalDonations:  0,
+		ledger:          ledger,
+		boxCollected:    boxCollected,
+		regulars:        NewVisitorRegistry(regulars),
+		archetypes:      archetypes,
+		schedule:        schedule,
+		clock:           schedule.NewClock(),
+		seed:            seed,
+		rng:             rand.New(rand.NewSource(seed)),
+		playerRng:       rand.New(rand.NewSource(seed)),
+		saveData:        saveData,
+		replay:          replay,
+		cleanliness:     1,
+		reputation:      NewReputation(),
+		speech:          NewSpeech(lines, seed),
+		donationQueue:   NewDonationQueue(shrineMap),
+		pathService:     NewPathService(defaultPathServiceWorker()),
+
+		nextWorshipperID: lastVisitorID,
+	}
+
+	// Pick up the calendar where the last session left off
+	if !startClock.IsZero() {
+		g.clock.Time = startClock
+	}
+
+	// Keep walking worshippers and the waiting line in sync with map edits
+	g.addMapChangeListener(g.invalidateWorshipperPaths)
+	g.addMapChangeListener(g.rebuildQueueLine)
+
+	// Find the chores of the map, and keep them in sync with map edits too
+	g.chores.Rebuild(g.shrineMap)
+	g.addMapChangeListener(g.rebuildChores)
+
+	// Remember where this session starts so it can be replayed
+	log.Printf("Simulation seed: %d", seed)
+	if replay {
+		log.Printf("Replaying the last session from %s, the save is left alone", g.clock.String())
 	}
+	saveData.StartClock = g.clock.Time
+	saveData.StartVisitorID = g.nextWorshipperID
+	saveData.StartRegulars = g.regulars.Snapshot()
+	saveData.StartBoxCollected = g.boxCollected
+	g.save()
+
+	return g
 }
 
 func createMikoShrineMap() [][]TileID {
@@ -662,48 +826,67 @@ func createMikoShrineMap() [][]TileID {
 }
 
 func (g *MikoGameWithWorshippers) Update() error {
+	// Read the touch controls and then the actions, and let the player change
+	// what they are bound to
+	g.updateTouch()
+	g.input.Update()
+	g.updateRebindScreen()
+
 	// Toggle edit mode
-	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+	if g.input.JustPressed(InputToggleEditor) {
 		g.editMode = !g.editMode
+		g.route = nil
 	}
 
 	if !g.editMode {
-		// Player movement with WASD
-		if ebiten.IsKeyPressed(ebiten.KeyW) || ebiten.IsKeyPressed(ebiten.KeyArrowUp) {
-			g.player.Y -= playerSpeed
-		}
-		if ebiten.IsKeyPressed(ebiten.KeyS) || ebiten.IsKeyPressed(ebiten.KeyArrowDown) {
-			g.player.Y += playerSpeed
-		}
-		if ebiten.IsKeyPressed(ebiten.KeyA) || ebiten.IsKeyPressed(ebiten.KeyArrowLeft) {
-			g.player.X -= playerSpeed
+		prevX, prevY := g.player.X, g.player.Y
+
+		// Player movement with the move actions, blocked by the tiles worshippers
+		// cannot walk on either. A stick tilted part of the way walks slower.
+		dx := (g.input.Value(InputMoveRight) - g.input.Value(InputMoveLeft)) * playerSpeed
+		dy := (g.input.Value(InputMoveDown) - g.input.Value(InputMoveUp)) * playerSpeed
+		if dx != 0 || dy != 0 {
+			// The keyboard or gamepad takes over from a click
+			g.route = nil
+		} else {
+			dx, dy = g.followRoute()
 		}
-		if ebiten.IsKeyPressed(ebiten.KeyD) || ebiten.IsKeyPressed(ebiten.KeyArrowRight) {
-			g.player.X += playerSpeed
+		if g.player.Inside {
+			dx, dy = 0, 0
 		}
+		g.player.face(dx, dy)
+		g.movePlayer(dx, dy)
 
-		// Keep player within map bounds
-		mapWidthPixels := float64(mikoMapWidth) * mikoTileSize * mikoScaleFactor
-		mapHeightPixels := float64(mikoMapHeight) * mikoTileSize * mikoScaleFactor
+		// Remember the actual movement so worshippers can anticipate it
+		g.player.VX = g.player.X - prevX
+		g.player.VY = g.player.Y - prevY
+		g.player.updateAnimation()
 
-		if g.player.X < 0 {
-			g.player.X = 0
-		}
-		if g.player.X > mapWidthPixels-g.player.Width {
-			g.player.X = mapWidthPixels - g.player.Width
-		}
-		if g.player.Y < 0 {
-			g.player.Y = 0
-		}
-		if g.player.Y > mapHeightPixels-g.player.Height {
-			g.player.Y = mapHeightPixels - g.player.Height
+		// Walk to where the player clicks or taps
+		g.updateClickMove()
+
+		// Do the shrine's chores
+		g.updateChores()
+
+		// Use the tile in front of her, or else talk to the visitors nearby
+		if !g.updateTileActions() {
+			g.updateInteraction()
 		}
 
+		// Export the ledger
+		g.updateLedgerExport()
+
+		// Open the visitor book
+		g.updateVisitorBook()
+
 		// Camera follows player
-		g.cameraX = g.player.X - float64(mikoScreenWidth)/2 + g.player.Width/2
-		g.cameraY = g.player.Y - float64(mikoScreenHeight)/2 + g.player.Height/2
+		playerX, playerY := playerCenter(g.player)
+		g.cameraX = playerX - float64(mikoScreenWidth)/2
+		g.cameraY = playerY - float64(mikoScreenHeight)/2
 
 		// Keep camera within bounds
+		mapWidthPixels := float64(mikoMapWidth) * mikoTileSize * mikoScaleFactor
+		mapHeightPixels := float64(mikoMapHeight) * mikoTileSize * mikoScaleFactor
 		maxCameraX := mapWidthPixels - float64(mikoScreenWidth)
 		maxCameraY := mapHeightPixels - float64(mikoScreenHeight)
 
@@ -719,93 +902,180 @@ func (g *MikoGameWithWorshippers) Update() error {
 		if g.cameraY > maxCameraY {
 			g.cameraY = maxCameraY
 		}
+
+		// Zoomed in, the view follows her too
+		g.touch.centerView(playerX-g.cameraX, playerY-g.cameraY)
 	} else {
 		// Edit mode controls
 		// Tile selection
-		if inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+		if g.input.JustPressed(InputTilePrevX) {
 			g.selectedTile.X--
 			if g.selectedTile.X < 0 {
 				g.selectedTile.X = 7
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		if g.input.JustPressed(InputTileNextX) {
 			g.selectedTile.X++
 			if g.selectedTile.X > 7 {
 				g.selectedTile.X = 0
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		if g.input.JustPressed(InputTilePrevY) {
 			g.selectedTile.Y--
 			if g.selectedTile.Y < 0 {
 				g.selectedTile.Y = 7
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+		if g.input.JustPressed(InputTileNextY) {
 			g.selectedTile.Y++
 			if g.selectedTile.Y > 7 {
 				g.selectedTile.Y = 0
 			}
 		}
 
-		// Place tile with mouse
-		if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
-			mx, my := ebiten.CursorPosition()
-			// Convert screen coordinates to map coordinates
-			mapX := int((float64(mx) + g.cameraX) / (mikoTileSize * mikoScaleFactor))
-			mapY := int((float64(my) + g.cameraY) / (mikoTileSize * mikoScaleFactor))
-
-			if mapX >= 0 && mapX < mikoMapWidth && mapY >= 0 && mapY < mikoMapHeight {
-				g.shrineMap[mapY][mapX] = g.selectedTile
+		// Place tile with the mouse, or a finger on the map
+		mx, my := ebiten.CursorPosition()
+		placing := ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft)
+		if g.touch.placing {
+			mx, my, placing = g.touch.placeX, g.touch.placeY, true
+		}
+		if placing && !g.rebind.Open {
+			if p := g.cursorTile(mx, my); isValidPosition(p) {
+				g.setTile(p, g.selectedTile)
 			}
 		}
 	}
 
-	// Reset camera with Space (only in edit mode)
-	if g.editMode && inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+	// Reset the camera and the zoom (only in edit mode)
+	if g.editMode && g.input.JustPressed(InputCameraReset) {
 		g.cameraX = 0
 		g.cameraY = 0
+		g.touch.resetZoom()
+	}
+
+	// Worshipper system updates at the chosen game speed, unless paused by the
+	// path debug step-through, which advances a single tick at a time
+	ticks := g.updateGameSpeed()
+	if g.updatePathDebug() {
+		if g.pathDebug.Stepping {
+			ticks = 1
+		}
+		for i := 0; i < ticks; i++ {
+			g.updateWorshippers()
+		}
 	}
 
-	// Worshipper system updates
-	g.updateWorshippers()
+	// Speech bubbles and notices stay up for the same real time at every game speed
+	g.speech.Update()
+	if g.noticeFrames > 0 {
+		g.noticeFrames--
+	}
+
+	g.updateAutosave()
 
 	return nil
 }
 
+// worshipperEnv returns what worshippers need from the game this frame
+func (g *MikoGameWithWorshippers) worshipperEnv() *WorshipperEnv {
+	return &WorshipperEnv{
+		ShrineMap: g.shrineMap,
+		Queue:     g.donationQueue,
+		Paths:     g.pathService,
+		Tick:      g.tick,
+		Rand:      g.rng,
+		Pool:      &g.worshippers,
+		Chores:    &g.chores,
+	}
+}
+
 func (g *MikoGameWithWorshippers) updateWorshippers() {
-	// Increment spawn timer
-	g.spawnTimer++
+	g.tick++
+	env := g.worshipperEnv()
+
+	// Hand out the paths computed since the last tick, and make the
+	// worshippers that have to give way plan again
+	for _, id := range g.pathService.Deliver() {
+		if worshipper := g.worshippers.ByID(id); worshipper != nil {
+			worshipper.PathInvalid = true
+		}
+	}
 
-	// Spawn new worshipper randomly
-	if g.spawnTimer >= spawnInterval && rand.Float64() < 0.3 { // 30% chance every spawn interval
-		g.worshippers = append(g.worshippers, NewWorshipper(g.worshipperImage, g.shrineMap))
-		g.spawnTimer = 0
+	// Spawn new worshippers as often as the schedule says for this time of day
+	g.clock.Advance()
+	g.updateCleanliness()
+	g.chores.Update(g.rng, &g.clock)
+	if g.schedule.ShouldSpawn(g.rng, &g.clock, g.worshippers.Len()) {
+		archetype := pickArchetype(g.rng, g.archetypes)
+		for _, worshipper := range g.spawnVisitors(archetype, env) {
+			g.worshippers.Add(worshipper)
+			g.litter()
+		}
 	}
 
+	// Regulars come back on their own schedule
+	g.spawnRegular(env)
+
 	// Update existing worshippers
-	for i := 0; i < len(g.worshippers); i++ {
-		worshipper := g.worshippers[i]
-		oldState := worshipper.State
+	for _, worshipper := range g.worshippers.All() {
+		wasPraying := worshipper.Praying
+		hadGivenUp := worshipper.GaveUp
+		hadLeftEarly := worshipper.LeftEarly
 
-		worshipper.Update(g.shrineMap)
+		worshipper.Update(env)
 
-		// Check if worshipper just started offering (for donation counting)
-		if oldState == StateApproaching && worshipper.State == StateOffering {
-			g.donationCount++
-			g.totalDonations++
+		// Enter the offering in the ledger as the worshipper starts praying
+		if !wasPraying && worshipper.Praying {
+			g.recordOffering(worshipper)
+			g.speech.Say(worshipper, SpeechPray)
+		}
+		if !hadGivenUp && worshipper.GaveUp {
+			g.gaveUpCount++
 		}
+		if !hadLeftEarly && worshipper.LeftEarly {
+			g.leftEarlyCount++
+		}
+	}
+
+	// Start the searches requested this tick
+	g.pathService.Dispatch(g.shrineMap, g.tick)
+
+	// Turn preferred velocities into movement that avoids collisions
+	g.steerWorshippers()
+	for _, worshipper := range g.worshippers.All() {
+		worshipper.updateAnimation()
+	}
+
+	// React to the crowd, the line, the grounds and the miko
+	g.updateMoods()
+	g.updateSpeech()
+
+	for i := 0; i < g.worshippers.Len(); i++ {
+		worshipper := g.worshippers.All()[i]
 
 		// Remove worshippers that are off screen
 		if worshipper.IsOffScreen() {
-			g.worshippers = append(g.worshippers[:i], g.worshippers[i+1:]...)
+			g.pathService.Release(worshipper.ID)
+			g.recordVisitor(worshipper)
+			worshipper.leaveGroup()
+			g.reputation.Add(worshipper.Rating())
+			g.speech.Forget(worshipper)
+			if g.interaction.Target == worshipper {
+				g.interaction.Target = nil
+			}
+			g.worshippers.Remove(i)
 			i--
 		}
 	}
 }
 
 func (g *MikoGameWithWorshippers) Draw(screen *ebiten.Image) {
+	// While zoomed in the world is drawn to a layer, scaled up onto the screen
+	// under the HUD
+	world := g.touch.worldLayer(screen)
+
 	// Clear screen
-	screen.Fill(color.RGBA{135, 206, 235, 255})
+	world.Fill(color.RGBA{135, 206, 235, 255})
 
 	// Draw the map
 	for y := 0; y < mikoMapHeight; y++ {
@@ -831,43 +1101,127 @@ func (g *MikoGameWithWorshippers) Draw(screen *ebiten.Image) {
 			op.GeoM.Scale(mikoScaleFactor, mikoScaleFactor)
 			op.GeoM.Translate(destX, destY)
 
-			screen.DrawImage(g.tilemapImage.SubImage(
+			world.DrawImage(g.tilemapImage.SubImage(
 				image.Rect(srcX, srcY, srcX+mikoTileSize, srcY+mikoTileSize),
 			).(*ebiten.Image), op)
 		}
 	}
 
-	// Draw worshippers
-	for _, worshipper := range g.worshippers {
-		g.drawWorshipper(screen, worshipper)
+	// Mark the chores and where the miko is walking to
+	if !g.editMode {
+		g.drawChores(world)
+		g.drawRoute(world)
 	}
 
-	// Draw player
-	if !g.editMode {
+	// Draw worshippers
+	g.drawWorshippers(world)
+
+	// Draw player, unless she is inside the haiden
+	if !g.editMode && !g.player.Inside {
 		playerOp := &ebiten.DrawImageOptions{}
-		playerScale := 0.125
-		playerOp.GeoM.Scale(playerScale, playerScale)
+		playerOp.GeoM.Scale(playerSpriteScale, playerSpriteScale)
 		playerOp.GeoM.Translate(g.player.X-g.cameraX, g.player.Y-g.cameraY)
-		screen.DrawImage(g.player.Image, playerOp)
+		g.player.Sprite.Draw(world, &g.player.Anim, playerOp)
 	}
 
+	// Mark the visitor the miko can talk to
+	g.drawInteractionTarget(world)
+	g.drawFacedTile(world)
+
+	// Draw what worshippers are saying
+	g.drawSpeechBubbles(world)
+
+	// Draw pathfinding debug overlay
+	g.drawPathDebug(world)
+	g.touch.drawZoomed(screen, world)
+
 	// Draw UI
 	info := fmt.Sprintf("巫女さんの神社探索 - 参拝客システム\nFPS: %.2f\n", ebiten.ActualFPS())
-	info += fmt.Sprintf("参拝客数: %d\n", len(g.worshippers))
-	info += fmt.Sprintf("現在の賽銭: %d\n", g.donationCount)
-	info += fmt.Sprintf("総賽銭: %d\n", g.totalDonations)
+	info += fmt.Sprintf("%s  速度: x%d\n", g.clock.String(), gameSpeeds[g.speedIndex])
+	info += fmt.Sprintf("シード: %d\n", g.seed)
+	forecast := fmt.Sprintf("来客予報: %.0f人/時", g.schedule.Rate(g.clock.Time))
+	if event := g.schedule.Event(g.clock.Time); event != nil {
+		forecast += " (" + event.Name + ")"
+	} else if g.clock.IsWeekend() {
+		forecast += " (週末)"
+	}
+	info += forecast + "\n"
+	praying := 0
+	for _, worshipper := range g.worshippers.All() {
+		if worshipper.Praying {
+			praying++
+		}
+	}
+	info += fmt.Sprintf("参拝客数: %d (参拝中: %d)\n", g.worshippers.Len(), praying)
+	if groups, members := g.groupCount(); groups > 0 {
+		info += fmt.Sprintf("団体: %d組 (%d人)\n", groups, members)
+	}
+	info += g.ledgerHUD()
+	info += g.offeringsHUD()
+	info += g.regularsHUD()
+	info += fmt.Sprintf("行列: %d人 (平均待ち時間: %.1f秒)\n", g.donationQueue.Len(), g.donationQueue.AverageWait()/60)
+	if g.gaveUpCount > 0 {
+		info += fmt.Sprintf("待ちきれずに参拝を諦めた: %d人\n", g.gaveUpCount)
+	}
+	if g.leftEarlyCount > 0 {
+		info += fmt.Sprintf("不満で早めに帰った: %d人\n", g.leftEarlyCount)
+	}
+	if mood := g.averageMood(); mood >= 0 {
+		info += fmt.Sprintf("満足度: %.0f%%\n", mood*100)
+	}
+	info += fmt.Sprintf("境内の清潔さ: %.0f%%\n", g.cleanliness*100)
+	info += g.choresHUD()
+	info += fmt.Sprintf("評判: ★%.1f (評価%d件)\n", g.reputation.Stars, g.reputation.Ratings)
+	if g.charmsSold > 0 {
+		info += fmt.Sprintf("お守り: %d個 (%d円)\n", g.charmsSold, g.charmYen)
+	}
+	confused := 0
+	for _, worshipper := range g.worshippers.All() {
+		if worshipper.State == StateConfused {
+			confused++
+		}
+	}
+	if confused > 0 {
+		info += fmt.Sprintf("迷子: %d人\n", confused)
+	}
+	if pending := g.pathService.Pending(); pending > 0 {
+		info += fmt.Sprintf("経路計算待ち: %d件\n", pending)
+	}
 
+	key := g.input.Label
 	if g.editMode {
 		tileKey := fmt.Sprintf("%d,%d", g.selectedTile.X, g.selectedTile.Y)
 		info += fmt.Sprintf("\n[編集モード]\n選択タイル: %s\n", tileKey)
-		info += "Q/R: タイルX選択, T/Y: タイルY選択\n左クリック: タイル配置\nSpace: カメラリセット"
+		info += fmt.Sprintf("%s/%s: タイルX選択, %s/%s: タイルY選択\n左クリック: タイル配置\n%s: カメラリセット",
+			key(InputTilePrevX), key(InputTileNextX), key(InputTilePrevY), key(InputTileNextY), key(InputCameraReset))
+		if g.touch.Enabled {
+			info += "\n指でなぞる: タイル配置  二本指: ズーム・スクロール"
+		}
 	} else {
 		info += fmt.Sprintf("\nプレイヤー位置: (%.0f, %.0f)\n", g.player.X, g.player.Y)
-		info += "WASD/矢印キー: 移動\nE: 編集モード切替"
+		info += fmt.Sprintf("%s/%s/%s/%s: 移動\nクリック/タップ: そこへ歩く\n", key(InputMoveUp), key(InputMoveLeft), key(InputMoveDown), key(InputMoveRight))
+		info += fmt.Sprintf("%s: 向いている場所を使う・参拝客に話しかける\n%s: 近くのお勤めをする\n%s: 編集モード切替\n%s: 経路デバッグ表示\n",
+			key(InputInteract), key(InputChore), key(InputToggleEditor), key(InputPathDebug))
+		info += fmt.Sprintf("%s/%s: ゲーム速度\n%s: 賽銭帳をCSVで書き出す\n%s: 参拝者名簿\n%s: 操作設定\n",
+			key(InputSlower), key(InputFaster), key(InputExportLedger), key(InputVisitorBook), key(InputBindings))
+		if g.touch.Enabled {
+			info += "左下のスティック: 移動  二本指でつまむ: ズーム\n"
+		}
+		info += g.routeHUD()
+		info += g.tileActionHUD()
+		info += g.interactionHUD()
+	}
+	if g.noticeFrames > 0 {
+		info += "\n" + g.notice + "\n"
 	}
 
 	ebitenutil.DebugPrint(screen, info)
 
+	// Draw the visitor book, the touch controls and the rebinding screen over the map
+	g.drawVisitorBook(screen)
+	g.drawTouchControls(screen)
+	g.drawRebindScreen(screen)
+
 	// Draw selected tile preview in edit mode
 	if g.editMode {
 		// Draw preview box
@@ -894,50 +1248,92 @@ func (g *MikoGameWithWorshippers) Draw(screen *ebiten.Image) {
 	}
 }
 
-func (g *MikoGameWithWorshippers) drawWorshipper(screen *ebiten.Image, worshipper *Worshipper) {
-	op := &ebiten.DrawImageOptions{}
+// drawWorshippers draws the worshippers in view, those further up the map
+// first. Their sprites go to the screen in one batch, the markers on top.
+func (g *MikoGameWithWorshippers) drawWorshippers(screen *ebiten.Image) {
+	const margin = 64 // Sprites and markers reach this far from a worshipper's position
+	visible := g.visibleBuffer[:0]
+	for _, worshipper := range g.worshippers.All() {
+		x, y := worshipper.X-g.cameraX, worshipper.Y-g.cameraY
+		if x < -margin || x > mikoScreenWidth+margin || y < -margin || y > mikoScreenHeight+margin {
+			continue
+		}
+		visible = append(visible, worshipper)
+	}
+	slices.SortFunc(visible, func(a, b *Worshipper) int {
+		if c := cmp.Compare(a.Y, b.Y); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+	g.visibleBuffer = visible
+
+	for _, worshipper := range visible {
+		g.batchWorshipper(screen, worshipper)
+	}
+	g.spriteBatch.Flush(screen)
+
+	for _, worshipper := range visible {
+		g.drawVisitEffect(screen, worshipper)
+		if worshipper.State == StateConfused {
+			g.drawConfusedMarker(screen, worshipper)
+		}
+		g.drawMoodMarker(screen, worshipper)
+		g.drawRegularTag(screen, worshipper)
+	}
+}
+
+// batchWorshipper adds the worshipper's sprite to the sprite batch
+func (g *MikoGameWithWorshippers) batchWorshipper(screen *ebiten.Image, worshipper *Worshipper) {
+	var geoM ebiten.GeoM
 
 	// Scale worshipper
-	scale := 0.1 // Smaller than player
-	op.GeoM.Scale(scale, scale)
+	geoM.Scale(worshipper.Scale, worshipper.Scale)
 
 	// Position with camera offset
-	op.GeoM.Translate(worshipper.X-g.cameraX, worshipper.Y-g.cameraY)
+	geoM.Translate(worshipper.X-g.cameraX, worshipper.Y-g.cameraY)
 
 	// Apply color tint
-	op.ColorScale.ScaleWithColor(worshipper.Color)
-
-	// Add special effects for different states
-	switch worshipper.State {
-	case StateOffering:
-		// Add a slight bounce effect while offering
-		bounceOffset := math.Sin(float64(worshipper.Timer)*0.3) * 2
-		op.GeoM.Translate(0, bounceOffset)
-	case StateLeaving:
-		// Fade out when leaving
+	var colorScale ebiten.ColorScale
+	colorScale.ScaleWithColor(worshipper.Color)
+
+	// Fade out when leaving
+	if worshipper.State == StateLeaving {
 		alpha := 1.0 - float64(worshipper.Timer)/300.0
 		if alpha < 0.3 {
 			alpha = 0.3
 		}
-		op.ColorScale.Scale(1, 1, 1, float32(alpha))
+		colorScale.Scale(1, 1, 1, float32(alpha))
 	}
 
-	screen.DrawImage(worshipper.Image, op)
+	g.spriteBatch.Add(screen, worshipper.Sprite, &worshipper.Anim, geoM, colorScale)
 }
 
 func (g *MikoGameWithWorshippers) Layout(outsideWidth, outsideHeight int) (int, int) {
 	return mikoScreenWidth, mikoScreenHeight
 }
 
-// Run with: go run miko_game_with_worshippers.go
+// Run with: go run miko_game_with_worshippers.go worshippers_*.go [-seed N | -replay] [-lang ja|en]
 func main() {
+	var options GameOptions
+	flag.Int64Var(&options.Seed, "seed", 0, "simulation seed, to replay a session exactly")
+	flag.BoolVar(&options.Replay, "replay", false, "replay the last session with its saved seed")
+	flag.StringVar(&options.Language, "lang", defaultLanguage, "language of the worshippers' speech bubbles (ja or en)")
+	flag.Parse()
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "seed" {
+			options.HasSeed = true
+		}
+	})
+
 	ebiten.SetWindowSize(mikoScreenWidth, mikoScreenHeight)
 	ebiten.SetWindowTitle("EdomaeElf - 巫女さんの神社探索（参拝客システム）")
 	ebiten.SetWindowResizingMode(ebiten.WindowResizingModeEnabled)
 
-	game := NewMikoGameWithWorshippers()
+	game := NewMikoGameWithWorshippers(options)
 
 	if err := ebiten.RunGame(game); err != nil {
 		log.Fatal(err)
 	}
+	game.save()
 }
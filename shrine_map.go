@@ -10,7 +10,8 @@ import (
 
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
-	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"EdomaeElf/input"
 )
 
 const (
@@ -20,8 +21,57 @@ const (
 	shrineScaleFactor  = 0.5  // タイルを半分のサイズで表示
 	mapWidth           = 16
 	mapHeight          = 12
+	bindingsFile       = "assets/data/shrine_map_input.json" // Keys, gamepad buttons and sticks of the actions
+)
+
+// Actions the player can take, read through their bindings
+const (
+	actionCameraUp input.Action = iota
+	actionCameraDown
+	actionCameraLeft
+	actionCameraRight
+	actionCameraReset  // Move the camera back to the corner
+	actionToggleEditor // Switch between viewing and editing the map
+	actionTilePrevX    // Pick the tile to place in the editor
+	actionTileNextX
+	actionTilePrevY
+	actionTileNextY
 )
 
+// gameActions names the actions in the config file
+var gameActions = []input.ActionInfo{
+	actionCameraUp:     {ID: "cameraUp", Label: "カメラ上へ"},
+	actionCameraDown:   {ID: "cameraDown", Label: "カメラ下へ"},
+	actionCameraLeft:   {ID: "cameraLeft", Label: "カメラ左へ"},
+	actionCameraRight:  {ID: "cameraRight", Label: "カメラ右へ"},
+	actionCameraReset:  {ID: "cameraReset", Label: "カメラリセット"},
+	actionToggleEditor: {ID: "toggleEditor", Label: "編集モード切替"},
+	actionTilePrevX:    {ID: "tilePrevX", Label: "タイルX-"},
+	actionTileNextX:    {ID: "tileNextX", Label: "タイルX+"},
+	actionTilePrevY:    {ID: "tilePrevY", Label: "タイルY-"},
+	actionTileNextY:    {ID: "tileNextY", Label: "タイルY+"},
+}
+
+// defaultBindings are the bindings used for actions the config file leaves
+// out, and when there is no config file
+func defaultBindings() [][]input.Binding {
+	key, pad, stick := input.Key, input.Pad, input.StickDirection
+	vertical, horizontal := ebiten.StandardGamepadAxisLeftStickVertical, ebiten.StandardGamepadAxisLeftStickHorizontal
+
+	b := make([][]input.Binding, len(gameActions))
+	b[actionCameraUp] = []input.Binding{key(ebiten.KeyArrowUp), key(ebiten.KeyW), pad(ebiten.StandardGamepadButtonLeftTop), stick(vertical, -1)}
+	b[actionCameraDown] = []input.Binding{key(ebiten.KeyArrowDown), key(ebiten.KeyS), pad(ebiten.StandardGamepadButtonLeftBottom), stick(vertical, 1)}
+	b[actionCameraLeft] = []input.Binding{key(ebiten.KeyArrowLeft), key(ebiten.KeyA), pad(ebiten.StandardGamepadButtonLeftLeft), stick(horizontal, -1)}
+	b[actionCameraRight] = []input.Binding{key(ebiten.KeyArrowRight), key(ebiten.KeyD), pad(ebiten.StandardGamepadButtonLeftRight), stick(horizontal, 1)}
+	b[actionCameraReset] = []input.Binding{key(ebiten.KeyHome), pad(ebiten.StandardGamepadButtonRightTop)}
+	b[actionToggleEditor] = []input.Binding{key(ebiten.KeyE), pad(ebiten.StandardGamepadButtonCenterLeft)}
+	b[actionTilePrevX] = []input.Binding{key(ebiten.KeyQ), pad(ebiten.StandardGamepadButtonFrontTopLeft)}
+	b[actionTileNextX] = []input.Binding{key(ebiten.KeyR), pad(ebiten.StandardGamepadButtonFrontTopRight)}
+	b[actionTilePrevY] = []input.Binding{key(ebiten.KeyT), pad(ebiten.StandardGamepadButtonFrontBottomLeft)}
+	b[actionTileNextY] = []input.Binding{key(ebiten.KeyY), pad(ebiten.StandardGamepadButtonFrontBottomRight)}
+	return b
+}
+
 // TileID represents a tile by its x,y position in the tileset
 type TileID struct {
 	X, Y int
@@ -39,6 +89,7 @@ type ShrineGame struct {
 	cameraY        float64
 	selectedTile   TileID
 	editMode       bool
+	input          input.Map // Keys, gamepad buttons and sticks, read through the actions they are bound to
 }
 
 func NewShrineGame() *ShrineGame {
@@ -60,6 +111,12 @@ func NewShrineGame() *ShrineGame {
 		log.Fatal(err)
 	}
 
+	// Load what the keys, gamepad buttons and sticks are bound to
+	inputMap := input.NewMap(gameActions, defaultBindings())
+	if err := inputMap.LoadFile(bindingsFile); err != nil {
+		log.Printf("Warning: Could not load bindings, using defaults: %v", err)
+	}
+
 	// Create the shrine map
 	shrineMap := createShrineMap()
 
@@ -71,6 +128,7 @@ func NewShrineGame() *ShrineGame {
 		cameraY:      0,
 		selectedTile: TileID{0, 0},
 		editMode:     false,
+		input:        inputMap,
 	}
 }
 
@@ -167,28 +225,20 @@ func createShrineMap() [][]TileID {
 }
 
 func (g *ShrineGame) Update() error {
+	g.input.Update()
+
 	// Toggle edit mode
-	if inpututil.IsKeyJustPressed(ebiten.KeyE) {
+	if g.input.JustPressed(actionToggleEditor) {
 		g.editMode = !g.editMode
 	}
 
-	// Camera movement
+	// Camera movement, slower with a stick tilted a little
 	speed := 5.0
-	if ebiten.IsKeyPressed(ebiten.KeyArrowLeft) || ebiten.IsKeyPressed(ebiten.KeyA) {
-		g.cameraX -= speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowRight) || ebiten.IsKeyPressed(ebiten.KeyD) {
-		g.cameraX += speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowUp) || ebiten.IsKeyPressed(ebiten.KeyW) {
-		g.cameraY -= speed
-	}
-	if ebiten.IsKeyPressed(ebiten.KeyArrowDown) || ebiten.IsKeyPressed(ebiten.KeyS) {
-		g.cameraY += speed
-	}
+	g.cameraX += (g.input.Value(actionCameraRight) - g.input.Value(actionCameraLeft)) * speed
+	g.cameraY += (g.input.Value(actionCameraDown) - g.input.Value(actionCameraUp)) * speed
 
 	// Reset camera
-	if inpututil.IsKeyJustPressed(ebiten.KeySpace) {
+	if g.input.JustPressed(actionCameraReset) {
 		g.cameraX = 0
 		g.cameraY = 0
 	}
@@ -196,25 +246,25 @@ func (g *ShrineGame) Update() error {
 	// Edit mode controls
 	if g.editMode {
 		// Tile selection
-		if inpututil.IsKeyJustPressed(ebiten.KeyQ) {
+		if g.input.JustPressed(actionTilePrevX) {
 			g.selectedTile.X--
 			if g.selectedTile.X < 0 {
 				g.selectedTile.X = 7
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyR) {
+		if g.input.JustPressed(actionTileNextX) {
 			g.selectedTile.X++
 			if g.selectedTile.X > 7 {
 				g.selectedTile.X = 0
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyT) {
+		if g.input.JustPressed(actionTilePrevY) {
 			g.selectedTile.Y--
 			if g.selectedTile.Y < 0 {
 				g.selectedTile.Y = 7
 			}
 		}
-		if inpututil.IsKeyJustPressed(ebiten.KeyY) {
+		if g.input.JustPressed(actionTileNextY) {
 			g.selectedTile.Y++
 			if g.selectedTile.Y > 7 {
 				g.selectedTile.Y = 0
@@ -277,9 +327,12 @@ func (g *ShrineGame) Draw(screen *ebiten.Image) {
 		tileKey := fmt.Sprintf("%d,%d", g.selectedTile.X, g.selectedTile.Y)
 		tileDesc := g.tileDesc[tileKey]
 		info += fmt.Sprintf("\n[編集モード]\n選択タイル: %s\n%s\n", tileKey, tileDesc)
-		info += "Q/R: タイルX選択, T/Y: タイルY選択\n左クリック: タイル配置"
+		info += fmt.Sprintf("%s/%s: タイルX選択, %s/%s: タイルY選択\n左クリック: タイル配置",
+			g.input.Label(actionTilePrevX), g.input.Label(actionTileNextX), g.input.Label(actionTilePrevY), g.input.Label(actionTileNextY))
 	} else {
-		info += "\n[表示モード]\n矢印キー/WASD: カメラ移動\nSpace: カメラリセット\nE: 編集モード切替"
+		info += fmt.Sprintf("\n[表示モード]\n%s/%s/%s/%s: カメラ移動\n%s: カメラリセット\n%s: 編集モード切替",
+			g.input.Label(actionCameraUp), g.input.Label(actionCameraLeft), g.input.Label(actionCameraDown), g.input.Label(actionCameraRight),
+			g.input.Label(actionCameraReset), g.input.Label(actionToggleEditor))
 	}
 	
 	ebitenutil.DebugPrint(screen, info)
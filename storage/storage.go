@@ -0,0 +1,13 @@
+// Package storage keeps small save files between sessions. Natively they are
+// files in the user's config directory; in the browser they live in
+// localStorage. Exported files are written to the working directory natively
+// and downloaded in the browser.
+package storage
+
+import "errors"
+
+// ErrNotFound is returned by Load when nothing was saved under the name yet
+var ErrNotFound = errors.New("storage: not found")
+
+// appName separates this game's saves from those of other programs
+const appName = "EdomaeElf"
@@ -0,0 +1,63 @@
+//go:build js
+
+package storage
+
+import (
+	"fmt"
+	"syscall/js"
+)
+
+// key returns the localStorage key for a save
+func key(name string) string {
+	return appName + "/" + name
+}
+
+// Load returns the data saved under the name
+func Load(name string) ([]byte, error) {
+	localStorage := js.Global().Get("localStorage")
+	if !localStorage.Truthy() {
+		return nil, fmt.Errorf("storage: localStorage is not available")
+	}
+	value := localStorage.Call("getItem", key(name))
+	if value.IsNull() {
+		return nil, ErrNotFound
+	}
+	return []byte(value.String()), nil
+}
+
+// Save replaces the data saved under the name
+func Save(name string, data []byte) (err error) {
+	localStorage := js.Global().Get("localStorage")
+	if !localStorage.Truthy() {
+		return fmt.Errorf("storage: localStorage is not available")
+	}
+	// setItem throws when the quota is exceeded
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("storage: saving %s: %v", name, r)
+		}
+	}()
+	localStorage.Call("setItem", key(name), string(data))
+	return nil
+}
+
+// Export hands a file to the user as a browser download and returns its name
+func Export(name string, data []byte) (string, error) {
+	document := js.Global().Get("document")
+	if !document.Truthy() {
+		return "", fmt.Errorf("storage: no document to download %s from", name)
+	}
+	array := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(array, data)
+	blob := js.Global().Get("Blob").New([]any{array}, map[string]any{"type": "application/octet-stream"})
+	url := js.Global().Get("URL").Call("createObjectURL", blob)
+	defer js.Global().Get("URL").Call("revokeObjectURL", url)
+
+	link := document.Call("createElement", "a")
+	link.Set("href", url)
+	link.Set("download", name)
+	document.Get("body").Call("appendChild", link)
+	link.Call("click")
+	link.Call("remove")
+	return name, nil
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"log"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+
+	"EdomaeElf/anim"
+)
+
+const (
+	// Animation constants
+	animationsFile = "assets/data/animations.json" // Sprite sheets and their clips
+
+	// Clips for visit actions and states that have no walk of their own
+	clipPurify   = "purify"   // Ladling water at the temizuya
+	clipAdmire   = "admire"   // Looking up at the sacred tree
+	clipConfused = "confused" // Looking around for a way
+)
+
+// Sprite is a sprite sheet with its image cut into cells
+type Sprite struct {
+	Sheet *anim.Sheet
+	image *ebiten.Image
+	cells []*ebiten.Image
+}
+
+// newSprite cuts the image into the sheet's cells
+func newSprite(sheet *anim.Sheet, img *ebiten.Image) *Sprite {
+	s := &Sprite{Sheet: sheet, image: img}
+	for _, r := range sheet.Cells(img.Bounds().Dx(), img.Bounds().Dy()) {
+		s.cells = append(s.cells, img.SubImage(r.Add(img.Bounds().Min)).(*ebiten.Image))
+	}
+	return s
+}
+
+// staticSprite shows the whole image without animating it
+func staticSprite(img *ebiten.Image) *Sprite {
+	return newSprite(&anim.Sheet{}, img)
+}
+
+// Cell returns the first cell, which sets the drawn size of the character
+func (s *Sprite) Cell() *ebiten.Image {
+	return s.cells[0]
+}
+
+// frame returns the cell of the animator's current frame and the GeoM that
+// draws it, given the GeoM that would place the first cell on the screen
+func (s *Sprite) frame(a *anim.Animator, geoM ebiten.GeoM) (*ebiten.Image, ebiten.GeoM) {
+	frame := a.Frame(s.Sheet)
+	cell := s.cells[0]
+	if frame.Cell < len(s.cells) {
+		cell = s.cells[frame.Cell]
+	}
+
+	var frameGeoM ebiten.GeoM
+	if frame.FlipX {
+		frameGeoM.Scale(-1, 1)
+		frameGeoM.Translate(float64(cell.Bounds().Dx()), 0)
+	}
+	frameGeoM.Concat(geoM)
+	frameGeoM.Translate(frame.DX, frame.DY)
+	return cell, frameGeoM
+}
+
+// Draw draws the animator's current frame. op places the cell on the screen
+// as it would place a single image.
+func (s *Sprite) Draw(screen *ebiten.Image, a *anim.Animator, op *ebiten.DrawImageOptions) {
+	frameOp := *op
+	cell, geoM := s.frame(a, op.GeoM)
+	frameOp.GeoM = geoM
+	screen.DrawImage(cell, &frameOp)
+}
+
+// SpriteBatch collects the frames of sprites cut from the same image and
+// draws them with one DrawTriangles call, instead of one draw per sprite.
+// Frames are drawn in the order they are added.
+type SpriteBatch struct {
+	image    *ebiten.Image
+	vertices []ebiten.Vertex
+	indices  []uint16
+}
+
+// Add queues the animator's current frame. geoM and colorScale place and
+// tint the cell as they would in Sprite.Draw. A sprite cut from another
+// image than the queued ones draws those first.
+func (b *SpriteBatch) Add(screen *ebiten.Image, s *Sprite, a *anim.Animator, geoM ebiten.GeoM, colorScale ebiten.ColorScale) {
+	if b.image != s.image || len(b.vertices)+4 > ebiten.MaxVertexCount {
+		b.Flush(screen)
+		b.image = s.image
+	}
+
+	cell, frameGeoM := s.frame(a, geoM)
+	bounds := cell.Bounds()
+	w, h := float64(bounds.Dx()), float64(bounds.Dy())
+	first := uint16(len(b.vertices))
+	for _, corner := range [4][2]float64{{0, 0}, {w, 0}, {0, h}, {w, h}} {
+		x, y := frameGeoM.Apply(corner[0], corner[1])
+		b.vertices = append(b.vertices, ebiten.Vertex{
+			DstX:   float32(x),
+			DstY:   float32(y),
+			SrcX:   float32(float64(bounds.Min.X) + corner[0]),
+			SrcY:   float32(float64(bounds.Min.Y) + corner[1]),
+			ColorR: colorScale.R(),
+			ColorG: colorScale.G(),
+			ColorB: colorScale.B(),
+			ColorA: colorScale.A(),
+		})
+	}
+	b.indices = append(b.indices, first, first+1, first+2, first+1, first+3, first+2)
+}
+
+// Flush draws the queued frames
+func (b *SpriteBatch) Flush(screen *ebiten.Image) {
+	if len(b.vertices) > 0 {
+		// Vertex colors scale the premultiplied image, like a DrawImage color scale
+		screen.DrawTriangles(b.vertices, b.indices, b.image, &ebiten.DrawTrianglesOptions{
+			ColorScaleMode: ebiten.ColorScaleModePremultipliedAlpha,
+		})
+	}
+	b.vertices = b.vertices[:0]
+	b.indices = b.indices[:0]
+}
+
+// loadSprites reads the sprite sheets from a JSON file and cuts their images,
+// keyed by image. images holds images that are already loaded, keyed by
+// file, and gains the ones loaded here. Sheets whose image fails to load or
+// is too small for their clips are left out.
+func loadSprites(path string, images map[string]*ebiten.Image) (map[*ebiten.Image]*Sprite, error) {
+	data, err := readDataFile(path)
+	if err != nil {
+		return nil, err
+	}
+	sheets, err := anim.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+
+	sprites := make(map[*ebiten.Image]*Sprite)
+	for _, sheet := range sheets {
+		img, ok := images[sheet.Image]
+		if !ok {
+			img, _, err = ebitenutil.NewImageFromFile(sheet.Image)
+			if err != nil {
+				log.Printf("Warning: Could not load sprite sheet %s: %v", sheet.Image, err)
+				continue
+			}
+			images[sheet.Image] = img
+		}
+		sprite := newSprite(sheet, img)
+		if sheet.MaxCell() >= len(sprite.cells) {
+			log.Printf("Warning: Sprite sheet %s has %d cells, its clips need %d", sheet.Image, len(sprite.cells), sheet.MaxCell()+1)
+			continue
+		}
+		sprites[img] = sprite
+	}
+	return sprites, nil
+}
+
+// spriteFor returns the animated sprite of the image, or a still one if no
+// sheet describes it
+func spriteFor(sprites map[*ebiten.Image]*Sprite, img *ebiten.Image) *Sprite {
+	if s, ok := sprites[img]; ok {
+		return s
+	}
+	return staticSprite(img)
+}
+
+// animationClip chooses the clip for what the worshipper is doing: the
+// action of the stop being visited, or walking the way they are moving
+func (w *Worshipper) animationClip() string {
+	switch w.State {
+	case StateVisiting:
+		stop := w.CurrentStop()
+		if stop == nil {
+			break
+		}
+		switch stop.Action {
+		case ActionBow:
+			return anim.Bow
+		case ActionPurify:
+			return clipPurify
+		case ActionPray:
+			if w.Praying {
+				return anim.Clap
+			}
+		case ActionAdmire:
+			return clipAdmire
+		}
+	case StateConfused:
+		return clipConfused
+	}
+	return anim.WalkClip(w.VX, w.VY)
+}
+
+// updateAnimation plays the clip for the worshipper's state and velocity for one tick
+func (w *Worshipper) updateAnimation() {
+	if w.Sprite == nil {
+		return
+	}
+	w.Anim.Play(w.animationClip())
+	w.Anim.Update(w.Sprite.Sheet, math.Hypot(w.VX, w.VY))
+}
+
+// updateAnimation plays the walk for the miko's last movement for one frame
+func (p *Player) updateAnimation() {
+	if p.Sprite == nil {
+		return
+	}
+	p.Anim.Play(anim.WalkClip(p.VX, p.VY))
+	p.Anim.Update(p.Sprite.Sheet, math.Hypot(p.VX, p.VY))
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"math/rand"
+
+	"EdomaeElf/behavior"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// archetypesFile lists the kinds of visitors and how often each one comes
+const archetypesFile = "assets/data/archetypes.json"
+
+// FloatRange is an inclusive range a value is drawn from
+type FloatRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Draw returns a random value in the range
+func (r FloatRange) Draw(rng *rand.Rand) float64 {
+	return r.Min + rng.Float64()*(r.Max-r.Min)
+}
+
+// IntRange is a range of whole numbers, both ends included
+type IntRange struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// Draw returns a random value in the range
+func (r IntRange) Draw(rng *rand.Rand) int {
+	return r.Min + rng.Intn(r.Max-r.Min+1)
+}
+
+// DonationChoice is a coin or bill a visitor may offer
+type DonationChoice struct {
+	Yen    int     `json:"yen"`
+	Weight float64 `json:"weight"` // Relative chance of offering it
+}
+
+// DonationTable is the distribution of the amounts a kind of visitor offers
+type DonationTable []DonationChoice
+
+// defaultDonations is mostly 5円 for good luck, with the occasional 10,000円 bill
+var defaultDonations = DonationTable{
+	{5, 40}, {10, 25}, {50, 10}, {100, 15}, {500, 6}, {1000, 3}, {10000, 1},
+}
+
+// Draw returns a random amount according to the weights
+func (t DonationTable) Draw(rng *rand.Rand) int {
+	total := 0.0
+	for _, c := range t {
+		total += c.Weight
+	}
+	r := rng.Float64() * total
+	for _, c := range t {
+		if r < c.Weight {
+			return c.Yen
+		}
+		r -= c.Weight
+	}
+	return t[len(t)-1].Yen
+}
+
+// StopPreferences are the chances that a visitor includes each optional stop
+// in the itinerary. Praying at the donation box is never skipped.
+type StopPreferences struct {
+	Bow    float64 `json:"bow"`    // Bow at the torii
+	Purify float64 `json:"purify"` // Purify hands at the temizuya
+	Admire float64 `json:"admire"` // Visit the sacred tree
+}
+
+// Archetype describes a kind of visitor: how they move, how long they are
+// willing to wait, what they visit and how much they give
+type Archetype struct {
+	ID       string          `json:"id"`
+	Name     string          `json:"name"`     // Display name
+	Weight   float64         `json:"weight"`   // Relative spawn weight
+	Speed    FloatRange      `json:"speed"`    // Walking speed in pixels per frame
+	Patience int             `json:"patience"` // Frames waited in line before giving up, 0 waits forever
+	CutIn    float64         `json:"cutIn"`    // Chance of pushing to the head of the line instead of waiting at the end
+	Stops    StopPreferences `json:"stops"`
+	Donation DonationTable   `json:"donation"`     // Coins and bills offered, defaultDonations if empty
+	Group    *GroupSpec      `json:"group"`        // Companions visitors of this kind may bring, always alone if nil
+	Return   float64         `json:"returnChance"` // Chance that a visitor who enjoyed coming alone becomes a regular
+	Sprite   string          `json:"sprite"`       // Image file, the default worshipper image if empty
+	Scale    float64         `json:"scale"`        // Sprite scale, worshipperSpriteScale if zero
+	Tints    [][3]uint8      `json:"tints"`        // Tint colors picked at random
+	Behavior json.RawMessage `json:"behavior"`     // Behavior tree of a visit alone, see behavior.Spec; built from the stops if empty
+
+	tree   *behavior.Spec // Parsed Behavior, nil to plan an itinerary from the stops
+	image  *ebiten.Image  // First cell of the sprite once the sheets are loaded
+	sprite *Sprite        // Set by the game, nil in headless runs
+}
+
+// archetypeFile is the layout of archetypesFile
+type archetypeFile struct {
+	Archetypes []*Archetype `json:"archetypes"`
+}
+
+// defaultArchetypes is used when the archetypes file cannot be loaded, and
+// behaves like visitors did before archetypes existed
+func defaultArchetypes(image *ebiten.Image) []*Archetype {
+	return []*Archetype{{
+		ID:       "visitor",
+		Name:     "参拝客",
+		Weight:   1,
+		Speed:    FloatRange{worshipperSpeed, worshipperSpeed + 0.5},
+		Stops:    StopPreferences{Bow: 1, Purify: 1, Admire: sacredTreeVisitChance},
+		Donation: defaultDonations,
+		Return:   0.1,
+		Scale:    worshipperSpriteScale,
+		Tints: [][3]uint8{
+			{255, 255, 255}, // White (no tint)
+			{255, 200, 200}, // Light red
+			{200, 255, 200}, // Light green
+			{200, 200, 255}, // Light blue
+			{255, 255, 200}, // Light yellow
+		},
+		image: image,
+	}}
+}
+
+// loadArchetypes reads the archetypes from a JSON file and loads their sprites.
+// images holds sprites that are already loaded, keyed by file. Sprites that
+// fail to load fall back to the default image.
+func loadArchetypes(path string, images map[string]*ebiten.Image, defaultImage *ebiten.Image) ([]*Archetype, error) {
+	data, err := readDataFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file archetypeFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(file.Archetypes) == 0 {
+		return nil, fmt.Errorf("%s defines no archetypes", path)
+	}
+
+	for _, a := range file.Archetypes {
+		if a.Weight < 0 || a.Speed.Min <= 0 || a.Speed.Max < a.Speed.Min {
+			return nil, fmt.Errorf("%s: archetype %q has an invalid weight or speed range", path, a.ID)
+		}
+		if a.Return < 0 || a.Return > 1 {
+			return nil, fmt.Errorf("%s: archetype %q has an invalid return chance", path, a.ID)
+		}
+		if a.Scale <= 0 {
+			a.Scale = worshipperSpriteScale
+		}
+		if len(a.Donation) == 0 {
+			a.Donation = defaultDonations
+		}
+		for _, c := range a.Donation {
+			if c.Yen <= 0 || c.Weight < 0 {
+				return nil, fmt.Errorf("%s: archetype %q has an invalid donation", path, a.ID)
+			}
+		}
+
+		if len(a.Behavior) > 0 {
+			spec, err := behavior.Parse(a.Behavior)
+			if err == nil {
+				err = checkVisitTree(spec)
+			}
+			if err != nil {
+				log.Printf("Warning: Archetype %q keeps to its stops, its behavior is invalid: %v", a.ID, err)
+			} else {
+				a.tree = &spec
+			}
+		}
+
+		a.image = defaultImage
+		if a.Sprite == "" {
+			continue
+		}
+		if img, ok := images[a.Sprite]; ok {
+			a.image = img
+			continue
+		}
+		img, _, err := ebitenutil.NewImageFromFile(a.Sprite)
+		if err != nil {
+			log.Printf("Warning: Could not load sprite %s for archetype %q: %v", a.Sprite, a.ID, err)
+			img = defaultImage
+		}
+		images[a.Sprite] = img
+		a.image = img
+	}
+	if err := linkGroups(file.Archetypes); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return file.Archetypes, nil
+}
+
+// linkGroups checks the archetypes' groups and looks up the archetypes of
+// their members
+func linkGroups(archetypes []*Archetype) error {
+	byID := make(map[string]*Archetype, len(archetypes))
+	for _, a := range archetypes {
+		byID[a.ID] = a
+	}
+	for _, a := range archetypes {
+		if a.Group == nil {
+			continue
+		}
+		if a.Group.Chance < 0 || a.Group.Chance > 1 {
+			return fmt.Errorf("archetype %q has an invalid group chance", a.ID)
+		}
+		for i := range a.Group.Members {
+			member := &a.Group.Members[i]
+			member.archetype = byID[member.Archetype]
+			if member.archetype == nil {
+				return fmt.Errorf("archetype %q brings unknown archetype %q", a.ID, member.Archetype)
+			}
+			if member.Count.Min < 0 || member.Count.Max < member.Count.Min {
+				return fmt.Errorf("archetype %q has an invalid count of %q", a.ID, member.Archetype)
+			}
+		}
+	}
+	return nil
+}
+
+// pickArchetype chooses an archetype at random according to the spawn weights
+func pickArchetype(rng *rand.Rand, archetypes []*Archetype) *Archetype {
+	total := 0.0
+	for _, a := range archetypes {
+		total += a.Weight
+	}
+	r := rng.Float64() * total
+	for _, a := range archetypes {
+		if r < a.Weight {
+			return a
+		}
+		r -= a.Weight
+	}
+	return archetypes[len(archetypes)-1]
+}
+
+// pickTint chooses one of the archetype's tint colors
+func (a *Archetype) pickTint(rng *rand.Rand) color.RGBA {
+	if len(a.Tints) == 0 {
+		return color.RGBA{255, 255, 255, 255}
+	}
+	t := a.Tints[rng.Intn(len(a.Tints))]
+	return color.RGBA{t[0], t[1], t[2], 255}
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"math/rand"
+
+	"EdomaeElf/behavior"
+)
+
+// newVisitBehavior builds the behavior tree of a visit: each stop of the
+// itinerary in turn, then home. A stop the visitor gives up on, because it
+// cannot be reached or the line is too long, is skipped.
+func newVisitBehavior(itinerary []VisitStop) behavior.Node {
+	var steps []behavior.Node
+	for _, stop := range itinerary {
+		visit := behavior.Sequence(
+			behavior.MoveTo(stop.Target),
+			behavior.Interact(stop.Action.String()),
+		)
+		steps = append(steps, behavior.Selector(visit, behavior.Succeed()))
+	}
+	steps = append(steps,
+		behavior.MoveTo(targetExit),
+		behavior.MoveTo(targetOffscreen),
+	)
+	return behavior.Sequence(steps...)
+}
+
+// newTreeBehavior builds the behavior tree of a visit from an archetype's
+// spec, then home. Visitors leave however the tree ends.
+func newTreeBehavior(spec behavior.Spec, rng *rand.Rand) (behavior.Node, error) {
+	tree, err := behavior.Build(spec, rng)
+	if err != nil {
+		return nil, err
+	}
+	return behavior.Sequence(
+		behavior.Selector(tree, behavior.Succeed()),
+		behavior.MoveTo(targetExit),
+		behavior.MoveTo(targetOffscreen),
+	), nil
+}
+
+// checkVisitTree reports whether a behavior tree from data only moves to the
+// landmarks and performs the actions worshippers know. Leaving is added by
+// newTreeBehavior, so the exit is not a target trees may name.
+func checkVisitTree(spec behavior.Spec) error {
+	if _, err := behavior.Build(spec, rand.New(rand.NewSource(0))); err != nil {
+		return err
+	}
+	var check func(spec behavior.Spec) error
+	check = func(spec behavior.Spec) error {
+		switch spec.Type {
+		case "moveTo":
+			switch spec.Target {
+			case targetTorii, targetTemizuya, targetOffering, targetSacredTree:
+			default:
+				return fmt.Errorf("unknown target %q", spec.Target)
+			}
+		case "interact":
+			if _, ok := stopActionByName(spec.Action); !ok {
+				return fmt.Errorf("unknown action %q", spec.Action)
+			}
+		}
+		for _, child := range spec.Children {
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return check(spec)
+}
+
+// planVisit plans the worshipper's stops and the behavior that visits them.
+// Visitors who come alone follow their archetype's behavior tree if it has
+// one; groups keep to an itinerary so that everyone visits the same stops.
+func (w *Worshipper) planVisit(env *WorshipperEnv, alone bool) {
+	if a := w.Archetype; alone && a.tree != nil {
+		node, err := newTreeBehavior(*a.tree, env.Rand)
+		if err == nil {
+			w.Itinerary = treeItinerary(env.ShrineMap, *a.tree)
+			w.Behavior = node
+			return
+		}
+		log.Printf("Warning: Could not build the behavior of archetype %q: %v", a.ID, err)
+	}
+	w.Itinerary = newItinerary(env.Rand, env.ShrineMap, w.Archetype.Stops)
+	w.Behavior = newVisitBehavior(w.Itinerary)
+}
+
+// worshipperAgent lets a behavior tree drive a worshipper
+type worshipperAgent struct {
+	w   *Worshipper
+	env *WorshipperEnv
+}
+
+// MoveTo walks the worshipper to a stop of its itinerary, the exit or off-screen
+func (a *worshipperAgent) MoveTo(target string, frame int) behavior.Status {
+	w, env := a.w, a.env
+
+	if target == targetOffscreen {
+		w.walkOffScreen()
+		return behavior.Running
+	}
+	// Visitors in a bad enough mood skip the rest of their stops, and leave their group
+	if target != targetExit && w.fedUp() {
+		env.Paths.Release(w.ID)
+		w.LeftEarly = true
+		w.leaveGroup()
+		return behavior.Failure
+	}
+
+	// Followers walk behind their leader. One who has been left to lead, or
+	// to go on alone, finds the way from here.
+	if w.isFollower() {
+		return a.follow(target, frame)
+	}
+	if frame == 0 || w.Following {
+		w.Following = false
+		if w.Group != nil {
+			w.Group.Step = w.stepOf(target)
+		}
+		if !a.startMove(target) {
+			return behavior.Failure
+		}
+	}
+
+	if w.State == StateConfused {
+		if w.updateConfused(env) {
+			env.Paths.Release(w.ID)
+			return behavior.Failure
+		}
+		return behavior.Running
+	}
+
+	// Line up behind the others once the tail of the queue is reached
+	if stop := w.CurrentStop(); stop != nil && stop.Action == ActionPray && env.Queue.ShouldJoin(w) {
+		return a.arrive(target)
+	}
+
+	// Replan if the map changed under the worshipper's feet
+	if w.PathInvalid {
+		w.requestPath(env, true)
+	}
+	if w.awaitingPath() || w.State == StateConfused {
+		return behavior.Running
+	}
+
+	// A group leader keeps stragglers in sight, and waits for everyone at the target
+	if w.Reached != target && w.Group != nil && w.Group.straggling() {
+		return behavior.Running
+	}
+	if w.Reached == target || w.atStopTile() || w.followPath(env.Tick) {
+		return a.arrive(target)
+	}
+	return behavior.Running
+}
+
+// arrive lets go of the path once the target is reached, then waits until
+// the worshipper's group has gathered there
+func (a *worshipperAgent) arrive(target string) behavior.Status {
+	w := a.w
+	if w.Reached != target {
+		a.env.Paths.Release(w.ID)
+	}
+	if !w.gather(target) {
+		return behavior.Running
+	}
+	return behavior.Success
+}
+
+// startMove picks the goal for a target and requests the path to it
+func (a *worshipperAgent) startMove(target string) bool {
+	w := a.w
+	if target == targetExit {
+		w.Stop = nil
+		w.State = StateLeaving
+		w.Goal = w.exitTile(a.env.ShrineMap)
+	} else {
+		w.Stop = w.stopFor(target)
+		if w.Stop == nil {
+			log.Printf("Warning: Worshipper %d has no stop %q", w.ID, target)
+			return false
+		}
+		w.State = StateWalking
+		w.Goal = w.Stop.Tile
+	}
+	w.Timer = 0
+	w.requestPath(a.env, false)
+	return true
+}
+
+// Interact performs the action of the current stop
+func (a *worshipperAgent) Interact(name string, frame int) behavior.Status {
+	w, env := a.w, a.env
+	action, ok := stopActionByName(name)
+	if !ok {
+		log.Printf("Warning: Unknown worshipper action %q", name)
+		return behavior.Failure
+	}
+
+	// Visitors in a bad enough mood walk off, unless already at the box
+	if w.fedUp() && !w.Praying && w.Slot < 0 {
+		if w.State == StateQueueing {
+			env.Queue.LeaveLine(w)
+		}
+		w.LeftEarly = true
+		w.leaveGroup()
+		return behavior.Failure
+	}
+
+	if frame == 0 {
+		w.Timer = 0
+		if action == ActionPray {
+			// Praying goes through the queue, which may put the worshipper in line first.
+			// Some visitors push in at the head of the line instead of waiting their
+			// turn, though not with their group watching.
+			env.Queue.Arrive(w)
+			if w.State == StateQueueing && w.Group == nil && w.Archetype != nil && w.Archetype.CutIn > 0 &&
+				env.Rand.Float64() < w.Archetype.CutIn {
+				w.cutInLine(env.Queue)
+			}
+		} else {
+			// There is nothing to purify with at an empty temizuya
+			if action == ActionPurify && !env.Chores.Use(ChoreTemizuya, temizuyaWaterPerUse) {
+				w.changeMood(-emptyTemizuyaMood)
+				return behavior.Failure
+			}
+			w.State = StateVisiting
+		}
+	}
+
+	if w.State == StateQueueing {
+		return w.waitInLine(env)
+	}
+
+	// Step into the praying slot before starting to pray
+	if action == ActionPray && !w.Praying {
+		if !w.moveToSpot(env.Queue.SlotPosition(w.Slot)) {
+			return behavior.Running
+		}
+		w.Praying = true
+	}
+
+	duration := defaultDuration(action)
+	if stop := w.CurrentStop(); stop != nil && stop.Action == action {
+		duration = stop.Duration
+	}
+	w.Timer++
+	if w.Timer < duration {
+		return behavior.Running
+	}
+
+	if action == ActionPray {
+		w.Prayed = true
+		env.Queue.Leave(w)
+		w.Praying = false
+	}
+	return behavior.Success
+}
+
+// waitInLine keeps up with the line as the people in front move forward.
+// Impatient visitors give up and fail the action, unless their group is
+// already praying and they are next.
+func (w *Worshipper) waitInLine(env *WorshipperEnv) behavior.Status {
+	w.QueueTimer++
+	if w.Patience > 0 && w.QueueTimer >= w.Patience && !w.groupAtBox() {
+		env.Queue.LeaveLine(w)
+		w.GaveUp = true
+		return behavior.Failure
+	}
+	w.moveToSpot(env.Queue.SpotPosition(w.QueueIndex))
+	return behavior.Running
+}
+
+// walkOffScreen heads past the edge of the map once the path to the exit is
+// done. TargetX is only 50px outside the map, so aim past it to clear the
+// removal margin.
+func (w *Worshipper) walkOffScreen() {
+	dx := w.TargetX + math.Copysign(100, w.TargetX) - w.X
+	dy := (float64(mikoMapHeight) * mikoTileSize * mikoScaleFactor) - w.Y
+	w.setPreferredVelocity(dx, dy, math.Sqrt(dx*dx+dy*dy))
+}
@@ -0,0 +1,416 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"math/rand"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// Shrine chore constants. A chore's level runs from 0 (nothing to do) to
+	// 1 (badly neglected).
+	petalPilesPerHour   = 2.0     // Piles of sakura petals that fall per in-game hour
+	petalPileLevel      = 0.35    // Level a pile adds to the tile it falls on
+	petalPilesMax       = 8       // Tiles petals lie on at most
+	petalMoodPerTick    = 0.00003 // Mood lost per fully covered tile
+	lanternLightHour    = 17      // Lanterns need lighting from this hour on
+	lanternOutHour      = 6       // Lanterns burn out at this hour
+	darkMoodPerTick     = 0.00005 // Mood lost at night with every lantern unlit, less when some are lit
+	temizuyaWaterPerUse = 0.02    // Level a visitor's purification adds to the temizuya
+	emptyTemizuyaMood   = 0.1     // Mood lost by a visitor who finds the temizuya empty
+	charmStock          = 20      // Omamori a restocked stall holds
+	choreShowAbove      = 0.25    // Chores are marked on the map from this level on
+	choreReach          = 32.0    // Pixels between the miko's hitbox and a chore's tile she can still work across
+	choreLevelTolerance = 1e-9    // Levels this close to 1 count as used up
+	chorePetalsPerLevel = 12      // Petals drawn on a fully covered tile
+	choreBarHeight      = 6.0     // Height of a chore's bar over its tile
+)
+
+// ChoreKind is a kind of chore the miko does around the shrine
+type ChoreKind int
+
+const (
+	ChoreSweep    ChoreKind = iota // Sweep fallen sakura petals off a tile
+	ChoreLantern                   // Light a stone lantern at dusk
+	ChoreTemizuya                  // Refill the water basin
+	ChoreCharms                    // Restock the amulet stall
+)
+
+// choreKindInfo is how a kind of chore is shown and how long it takes
+type choreKindInfo struct {
+	Name   string // Shown in the HUD while she walks there or works
+	Done   string // Notice once it is done
+	Frames int    // Frames of work it takes
+}
+
+// choreKinds describes the kinds of chores
+var choreKinds = map[ChoreKind]choreKindInfo{
+	ChoreSweep:    {Name: "花びらを掃く", Done: "花びらを掃いた", Frames: 90},
+	ChoreLantern:  {Name: "灯籠に火を入れる", Done: "灯籠に火を入れた", Frames: 60},
+	ChoreTemizuya: {Name: "手水鉢に水を足す", Done: "手水鉢を水で満たした", Frames: 120},
+	ChoreCharms:   {Name: "お守りを補充する", Done: "授与所にお守りを並べた", Frames: 150},
+}
+
+// choreTiles are the tiles that come with a chore, by tile kind. Petals are
+// swept wherever they fall, so sweeping has no tile of its own.
+var choreTiles = map[TileID]ChoreKind{
+	{2, 2}: ChoreLantern,  // Top of a stone lantern, where the light goes
+	{2, 4}: ChoreTemizuya, // Water basin
+	{4, 2}: ChoreCharms,   // Left end of the haiden veranda, where omamori are handed out
+}
+
+// lanternBase is the bottom tile of a stone lantern, below the tile its chore is on
+var lanternBase = TileID{3, 2}
+
+// Chore is something that needs doing at a tile of the shrine
+type Chore struct {
+	Kind     ChoreKind
+	Tile     Point
+	Level    float64 // How much it needs doing, from 0 to 1
+	Progress float64 // How far the miko has got with it, from 0 to 1
+}
+
+// Chores are the chores of the shrine and the one the miko is doing
+type Chores struct {
+	List    []*Chore
+	Working *Chore // Chore the miko is working on, nil if none
+	night   bool   // Lanterns are meant to be lit
+
+	petalTiles []Point // Tiles petals fall on
+}
+
+// isLanternTime reports whether the lanterns are meant to be lit at t
+func isLanternTime(t time.Time) bool {
+	return t.Hour() >= lanternLightHour || t.Hour() < lanternOutHour
+}
+
+// Rebuild finds the chores of the map, keeping those of tiles that did not
+// change. Lanterns put up at night start out unlit.
+func (c *Chores) Rebuild(shrineMap [][]TileID) {
+	old := make(map[Point]*Chore, len(c.List))
+	for _, chore := range c.List {
+		old[chore.Tile] = chore
+	}
+	c.List = c.List[:0]
+	c.petalTiles = c.petalTiles[:0]
+	for y := range shrineMap {
+		for x, tile := range shrineMap[y] {
+			p := Point{x, y}
+			if isWalkable(shrineMap, x, y) && nearCherryTree(shrineMap, p) {
+				c.petalTiles = append(c.petalTiles, p)
+			}
+
+			kind, ok := choreTiles[tile]
+			if !ok {
+				if chore := old[p]; chore != nil && chore.Kind == ChoreSweep && isWalkable(shrineMap, x, y) {
+					c.List = append(c.List, chore)
+				}
+				continue
+			}
+			if chore := old[p]; chore != nil && chore.Kind == kind {
+				c.List = append(c.List, chore)
+				continue
+			}
+			chore := &Chore{Kind: kind, Tile: p}
+			if kind == ChoreLantern && c.night {
+				chore.Level = 1
+			}
+			c.List = append(c.List, chore)
+		}
+	}
+
+	if c.Working != nil && c.At(c.Working.Tile) != c.Working {
+		c.Working = nil
+	}
+}
+
+// At returns the chore at a tile, nil if there is none
+func (c *Chores) At(p Point) *Chore {
+	for _, chore := range c.List {
+		if chore.Tile == p {
+			return chore
+		}
+	}
+	return nil
+}
+
+// fullest returns the chore of the kind that has the most left, nil if the
+// map has none
+func (c *Chores) fullest(kind ChoreKind) *Chore {
+	var best *Chore
+	for _, chore := range c.List {
+		if chore.Kind == kind && (best == nil || chore.Level < best.Level) {
+			best = chore
+		}
+	}
+	return best
+}
+
+// Empty reports whether every chore of the kind has run out. A map without
+// the chore's tile has nothing to run out of.
+func (c *Chores) Empty(kind ChoreKind) bool {
+	best := c.fullest(kind)
+	return best != nil && best.Level >= 1-choreLevelTolerance
+}
+
+// Use takes amount out of the chore of the kind that has the most left,
+// and reports whether there was anything left
+func (c *Chores) Use(kind ChoreKind, amount float64) bool {
+	if c.Empty(kind) {
+		return false
+	}
+	if best := c.fullest(kind); best != nil {
+		best.Level = math.Min(1, best.Level+amount)
+	}
+	return true
+}
+
+// Count returns the chores of a kind, and how many of them are marked
+func (c *Chores) Count(kind ChoreKind) (all, marked int) {
+	for _, chore := range c.List {
+		if chore.Kind != kind {
+			continue
+		}
+		all++
+		if chore.Level >= choreShowAbove {
+			marked++
+		}
+	}
+	return all, marked
+}
+
+// CharmsLeft returns the omamori left at the stalls
+func (c *Chores) CharmsLeft() int {
+	left := 0
+	for _, chore := range c.List {
+		if chore.Kind == ChoreCharms {
+			left += int(math.Round((1 - chore.Level) * charmStock))
+		}
+	}
+	return left
+}
+
+// Update lets petals fall and the lanterns need lighting as the day turns
+func (c *Chores) Update(rng *rand.Rand, clock *GameClock) {
+	if night := isLanternTime(clock.Time); night != c.night {
+		c.night = night
+		for _, chore := range c.List {
+			if chore.Kind == ChoreLantern {
+				chore.Level, chore.Progress = 0, 0
+				if night {
+					chore.Level = 1
+				}
+			}
+		}
+	}
+
+	if len(c.petalTiles) == 0 || rng.Float64() >= petalPilesPerHour*clock.PerTick.Hours() {
+		return
+	}
+	p := c.petalTiles[rng.Intn(len(c.petalTiles))]
+	if chore := c.At(p); chore != nil {
+		if chore.Kind == ChoreSweep {
+			chore.Level = math.Min(1, chore.Level+petalPileLevel)
+		}
+		return
+	}
+	if piles, _ := c.Count(ChoreSweep); piles < petalPilesMax {
+		c.List = append(c.List, &Chore{Kind: ChoreSweep, Tile: p, Level: petalPileLevel})
+	}
+}
+
+// moodLoss returns the mood every visitor loses per tick to the chores left
+// undone: petals underfoot, and dark lanterns at night
+func (c *Chores) moodLoss() float64 {
+	loss := 0.0
+	lanterns, unlit := 0, 0
+	for _, chore := range c.List {
+		switch chore.Kind {
+		case ChoreSweep:
+			loss += petalMoodPerTick * chore.Level
+		case ChoreLantern:
+			lanterns++
+			if chore.Level > 0 {
+				unlit++
+			}
+		}
+	}
+	if c.night && lanterns > 0 {
+		loss += darkMoodPerTick * float64(unlit) / float64(lanterns)
+	}
+	return loss
+}
+
+// rebuildChores keeps the chores in sync with map edits
+func (g *MikoGameWithWorshippers) rebuildChores(MapChange) {
+	g.chores.Rebuild(g.shrineMap)
+}
+
+// choreAt returns the chore of a tile, counting a lantern's base as part of
+// the lantern, nil if there is none
+func (g *MikoGameWithWorshippers) choreAt(p Point) *Chore {
+	if chore := g.chores.At(p); chore != nil {
+		return chore
+	}
+	if isValidPosition(p) && g.shrineMap[p.Y][p.X] == lanternBase {
+		if chore := g.chores.At(Point{p.X, p.Y - 1}); chore != nil && chore.Kind == ChoreLantern {
+			return chore
+		}
+	}
+	return nil
+}
+
+// choreAction returns the tile action that walks the miko to a chore and
+// starts it
+func choreAction(chore *Chore) *TileAction {
+	return &TileAction{Name: choreKinds[chore.Kind].Name, Reach: choreReach, Do: (*MikoGameWithWorshippers).startChore}
+}
+
+// nearChore reports whether the miko is close enough to a chore to work on
+// it. Her hitbox has to come within choreReach of its tile, which covers
+// every tile next to one she can stand on.
+func (g *MikoGameWithWorshippers) nearChore(chore *Chore) bool {
+	return g.reaches(chore.Tile, choreReach)
+}
+
+// nearestChore returns the chore closest to the miko that needs doing and
+// is in reach, nil if there is none
+func (g *MikoGameWithWorshippers) nearestChore() *Chore {
+	px, py := playerCenter(g.player)
+	var best *Chore
+	bestDistance := math.Inf(1)
+	for _, chore := range g.chores.List {
+		if chore.Level <= 0 || !g.nearChore(chore) {
+			continue
+		}
+		tx, ty := tileToPixel(chore.Tile)
+		if d := math.Hypot(tx-px, ty-py); d < bestDistance {
+			best, bestDistance = chore, d
+		}
+	}
+	return best
+}
+
+// startChore sets the miko to work on the chore at a tile
+func (g *MikoGameWithWorshippers) startChore(p Point) {
+	chore := g.choreAt(p)
+	switch {
+	case chore == nil:
+		return
+	case chore.Level <= 0:
+		g.notify("今はする必要がない")
+	case !g.nearChore(chore):
+		g.notify("そこまで届かない")
+	default:
+		g.chores.Working = chore
+		g.interaction.Target = nil
+	}
+}
+
+// updateChores lets the miko start the chore next to her and keeps
+// her at it while she stands still. Walking away leaves the work as far as
+// she got, to be finished later.
+func (g *MikoGameWithWorshippers) updateChores() {
+	if g.input.JustPressed(InputChore) && g.chores.Working == nil && !g.player.Inside {
+		if chore := g.nearestChore(); chore != nil {
+			g.startChore(chore.Tile)
+		} else {
+			g.notify("近くにお勤めはない")
+		}
+	}
+
+	chore := g.chores.Working
+	if chore == nil {
+		return
+	}
+	if g.player.VX != 0 || g.player.VY != 0 || chore.Level <= 0 || !g.nearChore(chore) {
+		g.chores.Working = nil
+		return
+	}
+	chore.Progress += 1 / float64(choreKinds[chore.Kind].Frames)
+	if chore.Progress < 1 {
+		return
+	}
+
+	g.chores.Working = nil
+	chore.Level, chore.Progress = 0, 0
+	if chore.Kind == ChoreSweep {
+		for i, c := range g.chores.List {
+			if c == chore {
+				g.chores.List = append(g.chores.List[:i], g.chores.List[i+1:]...)
+				break
+			}
+		}
+	}
+	g.notify("巫女: " + choreKinds[chore.Kind].Done)
+}
+
+// choresHUD returns the HUD lines about the chores
+func (g *MikoGameWithWorshippers) choresHUD() string {
+	var hud string
+	_, petals := g.chores.Count(ChoreSweep)
+	hud += fmt.Sprintf("お勤め: 花びら%dか所", petals)
+	if lanterns, unlit := g.chores.Count(ChoreLantern); lanterns > 0 && g.chores.night {
+		hud += fmt.Sprintf(" / 灯籠 %d/%d点灯", lanterns-unlit, lanterns)
+	}
+	for _, chore := range g.chores.List {
+		if chore.Kind == ChoreTemizuya {
+			hud += fmt.Sprintf(" / 手水 %.0f%%", (1-chore.Level)*100)
+			break
+		}
+	}
+	if stalls, _ := g.chores.Count(ChoreCharms); stalls > 0 {
+		hud += fmt.Sprintf(" / お守り 残り%d個", g.chores.CharmsLeft())
+	}
+	hud += "\n"
+	if chore := g.chores.Working; chore != nil {
+		hud += fmt.Sprintf("作業中: %s %.0f%%\n", choreKinds[chore.Kind].Name, chore.Progress*100)
+	}
+	return hud
+}
+
+// drawChores draws the petals on the ground and the light of the lanterns,
+// and a bar over every chore that needs doing: red for how neglected it is,
+// green for how far the miko has got with it
+func (g *MikoGameWithWorshippers) drawChores(screen *ebiten.Image) {
+	const size = mikoTileSize * mikoScaleFactor
+	for _, chore := range g.chores.List {
+		x := float64(chore.Tile.X)*size - g.cameraX
+		y := float64(chore.Tile.Y)*size - g.cameraY
+		if x < -size || x > mikoScreenWidth || y < -size || y > mikoScreenHeight {
+			continue
+		}
+
+		switch chore.Kind {
+		case ChoreSweep:
+			// Scatter the petals the same way every frame
+			petals := int(math.Ceil(chore.Level * chorePetalsPerLevel))
+			for i := 0; i < petals; i++ {
+				px := float64((i*37+chore.Tile.X*13+chore.Tile.Y*7)%56) + 4
+				py := float64((i*23+chore.Tile.X*5+chore.Tile.Y*11)%56) + 4
+				ebitenutil.DrawRect(screen, x+px, y+py, 3, 2, color.RGBA{255, 183, 197, 230})
+			}
+		case ChoreLantern:
+			if g.chores.night && chore.Level <= 0 {
+				ebitenutil.DrawCircle(screen, x+size/2, y+size/2, 14, color.RGBA{255, 190, 80, 90})
+				ebitenutil.DrawCircle(screen, x+size/2, y+size/2, 5, color.RGBA{255, 230, 150, 200})
+			}
+		}
+
+		if chore.Level < choreShowAbove && chore.Progress <= 0 {
+			continue
+		}
+		width := size - 16
+		ebitenutil.DrawRect(screen, x+8, y-choreBarHeight-2, width, choreBarHeight, color.RGBA{0, 0, 0, 170})
+		if chore.Progress > 0 {
+			ebitenutil.DrawRect(screen, x+8, y-choreBarHeight-2, width*chore.Progress, choreBarHeight, color.RGBA{80, 220, 100, 230})
+		} else {
+			ebitenutil.DrawRect(screen, x+8, y-choreBarHeight-2, width*chore.Level, choreBarHeight, color.RGBA{230, 70, 50, 230})
+		}
+	}
+}
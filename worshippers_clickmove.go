@@ -0,0 +1,308 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+)
+
+const (
+	// Click-to-move constants
+	routeArriveDistance = 0.01 // The miko has reached a waypoint this close to it
+	routeReplanFrames   = 60   // A route to a worshipper is planned again this often, as they keep walking
+	routeStuckFrames    = 30   // Frames without moving after which the miko gives up on a route
+	routeStuckDistance  = 0.1  // Moving less than this in a frame counts as not moving
+	routeFootMargin     = 2.0  // The miko walks with the bottom of her hitbox this far above the bottom of her tile
+)
+
+// blockedTile marks the tiles of the miko's map she cannot stand on
+var blockedTile = TileID{-1, -1}
+
+// PlayerRoute is a walk the miko takes by herself after a click or tap
+type PlayerRoute struct {
+	Path     []Point     // Tiles to walk through
+	Index    int         // Next tile to walk to
+	Goal     Point       // Tile clicked, marked on the map
+	TargetID int         // Worshipper to talk to at the end, 0 if none
+	Action   *TileAction // What to do at Goal at the end, nil if nothing
+	frames   int         // Frames since the route was planned
+	stuck    int         // Frames in a row the miko did not get anywhere
+}
+
+// cursorTile returns the map tile under a point on the screen
+func (g *MikoGameWithWorshippers) cursorTile(x, y int) Point {
+	sx, sy := g.touch.unzoom(x, y)
+	return pixelToTile(sx+g.cameraX, sy+g.cameraY)
+}
+
+// clicked returns where on the screen the player clicked or tapped this
+// frame. Touches on the joystick and buttons, and pinches, are not taps.
+func (g *MikoGameWithWorshippers) clicked() (int, int, bool) {
+	if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) {
+		x, y := ebiten.CursorPosition()
+		return x, y, true
+	}
+	if g.touch.tapped {
+		return g.touch.tapX, g.touch.tapY, true
+	}
+	return 0, 0, false
+}
+
+// worshipperAt returns the worshipper drawn at a point on the screen, the
+// one in front if several overlap, nil if there is none
+func (g *MikoGameWithWorshippers) worshipperAt(x, y int) *Worshipper {
+	sx, sy := g.touch.unzoom(x, y)
+	mx, my := sx+g.cameraX, sy+g.cameraY
+	var hit *Worshipper
+	for _, w := range g.worshippers.All() {
+		if w.State == StateLeaving {
+			continue
+		}
+		size := spriteSize(w.Image, w.Scale)
+		if mx >= w.X && mx < w.X+size && my >= w.Y && my < w.Y+size && (hit == nil || w.Y > hit.Y) {
+			hit = w
+		}
+	}
+	return hit
+}
+
+// Feet returns the middle of the bottom edge of the miko's hitbox
+func (p *Player) Feet() (float64, float64) {
+	x0, _, x1, y1 := p.Hitbox()
+	return (x0 + x1) / 2, y1
+}
+
+// standsOn returns the tile the miko stands on
+func (p *Player) standsOn() Point {
+	x, y := p.Feet()
+	return pixelToTile(x, y-routeFootMargin)
+}
+
+// playerMap returns the shrine map as the miko walks it. Her hitbox reaches
+// into the tile above the one she stands on, so she can only stand where
+// that tile is walkable as well.
+func (g *MikoGameWithWorshippers) playerMap() [][]TileID {
+	m := make([][]TileID, len(g.shrineMap))
+	for y := range g.shrineMap {
+		m[y] = make([]TileID, len(g.shrineMap[y]))
+		for x, tile := range g.shrineMap[y] {
+			m[y][x] = tile
+			if !isWalkable(g.shrineMap, x, y-1) {
+				m[y][x] = blockedTile
+			}
+		}
+	}
+	return m
+}
+
+// standingTile returns the tile closest to p the miko can stand on: p
+// itself, the tile next to it nearest to her, or the nearest one further away
+func (g *MikoGameWithWorshippers) standingTile(playerMap [][]TileID, p Point) (Point, bool) {
+	if isWalkable(playerMap, p.X, p.Y) {
+		return p, true
+	}
+	px, py := g.player.Feet()
+	best, found, bestDistance := Point{}, false, math.Inf(1)
+	for dy := -1; dy <= 1; dy++ {
+		for dx := -1; dx <= 1; dx++ {
+			n := Point{p.X + dx, p.Y + dy}
+			if !isWalkable(playerMap, n.X, n.Y) {
+				continue
+			}
+			x, y := tileToPixel(n)
+			if d := math.Hypot(x-px, y-py); d < bestDistance {
+				best, found, bestDistance = n, true, d
+			}
+		}
+	}
+	if found {
+		return best, true
+	}
+	x, y := tileToPixel(p)
+	near, err := findNearestWalkableTile(playerMap, x, y)
+	return near, err == nil
+}
+
+// planRoute finds the way from the tile the miko stands on to the goal, or
+// as close to it as she can stand. It returns nil if there is no way.
+func (g *MikoGameWithWorshippers) planRoute(goal Point) []Point {
+	playerMap := g.playerMap()
+	goal, ok := g.standingTile(playerMap, goal)
+	if !ok {
+		return nil
+	}
+	path, err := findPath(playerMap, g.player.standsOn(), goal)
+	if err != nil {
+		return nil
+	}
+	return path
+}
+
+// updateClickMove starts a route to where the player clicked or tapped.
+// Clicking a worshipper walks up to them and opens the interaction menu,
+// clicking a tile with an action or a chore walks up to it and does it.
+func (g *MikoGameWithWorshippers) updateClickMove() {
+	x, y, ok := g.clicked()
+	if !ok || g.visitorBook.Open || g.rebind.Open || g.player.Inside {
+		return
+	}
+
+	if w := g.worshipperAt(x, y); w != nil {
+		if g.distanceToPlayer(w) < interactRange {
+			g.route = nil
+			g.interaction.Target = w
+			return
+		}
+		g.startRoute(&PlayerRoute{Goal: pixelToTile(worshipperCenter(w)), TargetID: w.ID})
+		return
+	}
+
+	goal := g.cursorTile(x, y)
+	if !isValidPosition(goal) {
+		return
+	}
+	route := &PlayerRoute{Goal: goal}
+	if chore := g.choreAt(goal); chore != nil && chore.Level > 0 {
+		route.Goal, route.Action = chore.Tile, choreAction(chore)
+	} else if action, ok := tileActions[g.shrineMap[goal.Y][goal.X]]; ok {
+		route.Action = &action
+	}
+	g.startRoute(route)
+}
+
+// startRoute plans the route to the goal and sets the miko off along it
+func (g *MikoGameWithWorshippers) startRoute(route *PlayerRoute) {
+	route.Path = g.planRoute(route.Goal)
+	if route.Path == nil {
+		g.route = nil
+		g.notify("そこへは行けない")
+		return
+	}
+	g.interaction.Target = nil
+	g.route = route
+}
+
+// followRoute returns the miko's movement along her route this frame, and
+// finishes the route once she has arrived
+func (g *MikoGameWithWorshippers) followRoute() (float64, float64) {
+	route := g.route
+	if route == nil {
+		return 0, 0
+	}
+	route.frames++
+	if route.frames > 1 && math.Hypot(g.player.VX, g.player.VY) < routeStuckDistance {
+		route.stuck++
+		if route.stuck >= routeStuckFrames {
+			g.route = nil
+			g.notify("そこへは行けない")
+			return 0, 0
+		}
+	} else {
+		route.stuck = 0
+	}
+
+	if route.TargetID != 0 {
+		w := g.worshippers.ByID(route.TargetID)
+		if w == nil || w.State == StateLeaving {
+			g.route = nil
+			return 0, 0
+		}
+		if g.distanceToPlayer(w) < interactRange {
+			g.route = nil
+			g.interaction.Target = w
+			return 0, 0
+		}
+		if route.frames%routeReplanFrames == 0 {
+			if path := g.planRoute(pixelToTile(worshipperCenter(w))); path != nil {
+				route.Path, route.Index = path, 0
+			}
+		}
+	}
+	if route.Action != nil {
+		// Where the path ends may be far from a walled in goal, so the action
+		// is only done if she can reach the goal from there
+		gx, gy := tileToPixel(route.Goal)
+		px, py := playerCenter(g.player)
+		arrived := route.Index >= len(route.Path)
+		switch {
+		case g.reaches(route.Goal, route.Action.Reach) && (arrived || math.Hypot(gx-px, gy-py) < interactRange):
+			g.route = nil
+			g.player.face(gx-px, gy-py)
+			route.Action.Do(g, route.Goal)
+			return 0, 0
+		case arrived:
+			g.route = nil
+			g.notify("そこまで届かない")
+			return 0, 0
+		}
+	}
+
+	// Put her feet in the middle of the next tile, just above its bottom edge
+	px, py := g.player.Feet()
+	for route.Index < len(route.Path) {
+		tx, ty := tileToPixel(route.Path[route.Index])
+		ty += mikoTileSize*mikoScaleFactor/2 - routeFootMargin
+		dx, dy := tx-px, ty-py
+		distance := math.Hypot(dx, dy)
+		if distance < routeArriveDistance {
+			route.Index++
+			continue
+		}
+		step := math.Min(playerSpeed, distance)
+		return dx / distance * step, dy / distance * step
+	}
+
+	// Past the end of the path, catch up with the worshipper who walked on
+	if w := g.worshippers.ByID(route.TargetID); w != nil {
+		cx, cy := playerCenter(g.player)
+		wx, wy := worshipperCenter(w)
+		distance := math.Hypot(wx-cx, wy-cy)
+		return (wx - cx) / distance * playerSpeed, (wy - cy) / distance * playerSpeed
+	}
+	if route.Action == nil {
+		g.route = nil
+	}
+	return 0, 0
+}
+
+// routeHUD returns the HUD line about the miko's walk, empty if she is not on one
+func (g *MikoGameWithWorshippers) routeHUD() string {
+	route := g.route
+	switch {
+	case route == nil:
+		return ""
+	case route.TargetID != 0:
+		if w := g.worshippers.ByID(route.TargetID); w != nil {
+			return fmt.Sprintf("移動中: %sのところへ\n", w.displayName())
+		}
+	case route.Action != nil:
+		return fmt.Sprintf("移動中: %s\n", route.Action.Name)
+	}
+	return "移動中\n"
+}
+
+// drawRoute marks the miko's destination and the tiles she still walks through
+func (g *MikoGameWithWorshippers) drawRoute(screen *ebiten.Image) {
+	route := g.route
+	if route == nil {
+		return
+	}
+	for _, p := range route.Path[min(route.Index, len(route.Path)):] {
+		x, y := tileToPixel(p)
+		ebitenutil.DrawRect(screen, x-g.cameraX-2, y-g.cameraY-2, 4, 4, color.RGBA{255, 255, 255, 160})
+	}
+
+	const size = mikoTileSize * mikoScaleFactor
+	x := float64(route.Goal.X)*size - g.cameraX
+	y := float64(route.Goal.Y)*size - g.cameraY
+	mark := color.RGBA{255, 220, 0, 200}
+	ebitenutil.DrawRect(screen, x, y, size, 3, mark)
+	ebitenutil.DrawRect(screen, x, y+size-3, size, 3, mark)
+	ebitenutil.DrawRect(screen, x, y, 3, size, mark)
+	ebitenutil.DrawRect(screen, x+size-3, y, 3, size, mark)
+	ebitenutil.DrawRect(screen, x+size/2-4, y+size/2-4, 8, 8, mark)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+// scheduleFile holds the in-game calendar settings and the spawn curves
+const scheduleFile = "assets/data/schedule.json"
+
+// scheduleTimeLayout is the format of the start time in the schedule file
+const scheduleTimeLayout = "2006-01-02T15:04"
+
+// gameSpeeds are the simulation ticks run per frame at each speed setting
+var gameSpeeds = []int{1, 2, 4, 8}
+
+// japaneseWeekdays are the short weekday names shown in the HUD
+var japaneseWeekdays = [...]string{"日", "月", "火", "水", "木", "金", "土"}
+
+// GameClock is the in-game date and time. It advances with every simulation
+// tick, so it runs faster or slower together with the game speed.
+type GameClock struct {
+	Time    time.Time     // Current in-game time
+	PerTick time.Duration // In-game time that passes per simulation tick
+}
+
+// Advance moves the clock forward by one tick
+func (c *GameClock) Advance() {
+	c.Time = c.Time.Add(c.PerTick)
+}
+
+// IsWeekend reports whether the current day is a Saturday or Sunday
+func (c *GameClock) IsWeekend() bool {
+	day := c.Time.Weekday()
+	return day == time.Saturday || day == time.Sunday
+}
+
+// String formats the clock for the HUD, e.g. 2025年12月31日(水) 06:00
+func (c *GameClock) String() string {
+	t := c.Time
+	return fmt.Sprintf("%d年%d月%d日(%s) %02d:%02d",
+		t.Year(), int(t.Month()), t.Day(), japaneseWeekdays[t.Weekday()], t.Hour(), t.Minute())
+}
+
+// SpawnEvent changes the spawn curve on certain days of the year
+type SpawnEvent struct {
+	Name       string    `json:"name"`
+	From       string    `json:"from"`       // First day, "MM-DD"
+	To         string    `json:"to"`         // Last day, "MM-DD"
+	Multiplier float64   `json:"multiplier"` // Applied to the day's usual curve, 1 if zero
+	Hourly     []float64 `json:"hourly"`     // Replaces the usual curve if set
+}
+
+// matches reports whether the event is on the given day. Ranges may wrap
+// around the new year, e.g. from 12-31 to 01-03.
+func (e *SpawnEvent) matches(t time.Time) bool {
+	day := fmt.Sprintf("%02d-%02d", int(t.Month()), t.Day())
+	if e.From <= e.To {
+		return e.From <= day && day <= e.To
+	}
+	return day >= e.From || day <= e.To
+}
+
+// SpawnSchedule decides how many visitors come at each time of the day.
+// The curves give visitors per in-game hour for each hour from 0 to 23.
+type SpawnSchedule struct {
+	Start          string       `json:"start"`          // In-game start time, see scheduleTimeLayout
+	SecondsPerTick float64      `json:"secondsPerTick"` // In-game seconds per simulation tick
+	MaxVisitors    int          `json:"maxVisitors"`    // No spawns while this many are on the map, 0 for no limit
+	Weekday        []float64    `json:"weekday"`
+	Weekend        []float64    `json:"weekend"`
+	Events         []SpawnEvent `json:"events"` // The first matching event applies
+}
+
+// defaultSpawnSchedule is used when the schedule file cannot be loaded. A flat
+// curve with about as many visitors as one every 1000 frames.
+func defaultSpawnSchedule() *SpawnSchedule {
+	flat := make([]float64, 24)
+	for i := range flat {
+		flat[i] = 3.6
+	}
+	return &SpawnSchedule{
+		Start:          "2025-12-31T06:00",
+		SecondsPerTick: 1,
+		Weekday:        flat,
+		Weekend:        flat,
+	}
+}
+
+// loadSpawnSchedule reads the schedule from a JSON file
+func loadSpawnSchedule(path string) (*SpawnSchedule, error) {
+	data, err := readDataFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var s SpawnSchedule
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	if len(s.Weekday) != 24 || len(s.Weekend) != 24 {
+		return nil, fmt.Errorf("%s: weekday and weekend curves need 24 hourly values", path)
+	}
+	for _, e := range s.Events {
+		if e.Hourly != nil && len(e.Hourly) != 24 {
+			return nil, fmt.Errorf("%s: event %q needs 24 hourly values", path, e.Name)
+		}
+	}
+	if s.SecondsPerTick <= 0 {
+		return nil, fmt.Errorf("%s: secondsPerTick must be positive", path)
+	}
+	if _, err := time.Parse(scheduleTimeLayout, s.Start); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &s, nil
+}
+
+// NewClock returns a clock set to the schedule's start time
+func (s *SpawnSchedule) NewClock() GameClock {
+	start, err := time.Parse(scheduleTimeLayout, s.Start)
+	if err != nil {
+		log.Printf("Warning: Invalid start time %q, starting now: %v", s.Start, err)
+		start = time.Now().UTC().Truncate(time.Minute)
+	}
+	return GameClock{
+		Time:    start,
+		PerTick: time.Duration(s.SecondsPerTick * float64(time.Second)),
+	}
+}
+
+// Event returns the event on the given day, nil if there is none
+func (s *SpawnSchedule) Event(t time.Time) *SpawnEvent {
+	for i := range s.Events {
+		if s.Events[i].matches(t) {
+			return &s.Events[i]
+		}
+	}
+	return nil
+}
+
+// Rate returns the expected visitors per in-game hour at the given time,
+// interpolated between the hourly values of the curve. The last hour of a
+// day blends into the first hour of the next, with that day's curve.
+func (s *SpawnSchedule) Rate(t time.Time) float64 {
+	hour := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+	f := t.Sub(hour).Hours()
+	return s.hourlyRate(hour)*(1-f) + s.hourlyRate(hour.Add(time.Hour))*f
+}
+
+// hourlyRate returns the value of the curve for t's day at the start of t's hour
+func (s *SpawnSchedule) hourlyRate(t time.Time) float64 {
+	curve := s.Weekday
+	if day := t.Weekday(); day == time.Saturday || day == time.Sunday {
+		curve = s.Weekend
+	}
+	multiplier := 1.0
+	if e := s.Event(t); e != nil {
+		if e.Hourly != nil {
+			curve = e.Hourly
+		}
+		if e.Multiplier > 0 {
+			multiplier = e.Multiplier
+		}
+	}
+	return curve[t.Hour()] * multiplier
+}
+
+// ShouldSpawn rolls whether a visitor arrives during this tick
+func (s *SpawnSchedule) ShouldSpawn(rng *rand.Rand, clock *GameClock, visitors int) bool {
+	if s.MaxVisitors > 0 && visitors >= s.MaxVisitors {
+		return false
+	}
+	chance := s.Rate(clock.Time) * clock.PerTick.Hours()
+	return rng.Float64() < chance
+}
+
+// updateGameSpeed handles the speed keys and returns the ticks to simulate
+// this frame
+func (g *MikoGameWithWorshippers) updateGameSpeed() int {
+	if g.input.JustPressed(InputSlower) && g.speedIndex > 0 {
+		g.speedIndex--
+	}
+	if g.input.JustPressed(InputFaster) && g.speedIndex < len(gameSpeeds)-1 {
+		g.speedIndex++
+	}
+	return gameSpeeds[g.speedIndex]
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+// debugPathTrace receives the search of every findPath call while the
+// pathfinding debug overlay is enabled, nil otherwise
+var debugPathTrace *PathSearchTrace
+
+// PathSearchStep is one iteration of the A* main loop
+type PathSearchStep struct {
+	Expanded Point   // Node moved to the closed set
+	Opened   []Point // Nodes added to the open set or given a better parent
+}
+
+// PathSearchTrace records how a single findPath call explored the map
+type PathSearchTrace struct {
+	Start, Goal Point
+	Steps       []PathSearchStep
+	Path        []Point
+	Err         error
+}
+
+func (t *PathSearchTrace) reset(start, goal Point) {
+	t.Start = start
+	t.Goal = goal
+	t.Steps = t.Steps[:0]
+	t.Path = nil
+	t.Err = nil
+}
+
+func (t *PathSearchTrace) addOpened(p Point) {
+	if len(t.Steps) == 0 {
+		return
+	}
+	step := &t.Steps[len(t.Steps)-1]
+	step.Opened = append(step.Opened, p)
+}
+
+// setsAt returns the open and closed sets after the given number of expansions
+func (t *PathSearchTrace) setsAt(steps int) (open, closed map[Point]bool) {
+	open = map[Point]bool{t.Start: true}
+	closed = make(map[Point]bool)
+	for _, step := range t.Steps[:steps] {
+		delete(open, step.Expanded)
+		closed[step.Expanded] = true
+		for _, p := range step.Opened {
+			open[p] = true
+		}
+	}
+	return open, closed
+}
+
+// PathDebugOverlay shows what the pathfinding is doing on top of the map
+type PathDebugOverlay struct {
+	Enabled  bool
+	Stepping bool // Simulation paused, search revealed one expansion at a time
+	Step     int  // Number of expansions shown while stepping
+	trace    PathSearchTrace
+}
+
+var (
+	debugWalkableColor = color.RGBA{0, 160, 0, 60}
+	debugBlockedColor  = color.RGBA{200, 0, 0, 70}
+	debugClosedColor   = color.RGBA{60, 90, 220, 110}
+	debugOpenColor     = color.RGBA{240, 200, 0, 130}
+	debugSearchColor   = color.RGBA{255, 255, 255, 230}
+	debugPathColor     = color.RGBA{255, 80, 200, 255}
+	debugTargetColor   = color.RGBA{255, 255, 0, 255}
+)
+
+// updatePathDebug handles the overlay keys and reports whether the
+// simulation should advance this frame
+func (g *MikoGameWithWorshippers) updatePathDebug() bool {
+	d := &g.pathDebug
+
+	// Toggle the overlay
+	if g.input.JustPressed(InputPathDebug) {
+		d.Enabled = !d.Enabled
+		d.Stepping = false
+		if d.Enabled {
+			debugPathTrace = &d.trace
+		} else {
+			debugPathTrace = nil
+		}
+	}
+	if !d.Enabled {
+		return true
+	}
+
+	// Toggle step-through mode
+	if g.input.JustPressed(InputDebugStepping) {
+		d.Stepping = !d.Stepping
+		d.Step = 0
+	}
+	if !d.Stepping {
+		return true
+	}
+
+	// Step the most recent search backwards and forwards
+	if g.input.JustPressed(InputDebugStepAhead) && d.Step < len(d.trace.Steps) {
+		d.Step++
+	}
+	if g.input.JustPressed(InputDebugStepBack) && d.Step > 0 {
+		d.Step--
+	}
+
+	// Advance the simulation by a single frame
+	if g.input.JustPressed(InputDebugAdvance) {
+		d.Step = 0
+		return true
+	}
+	return false
+}
+
+// drawPathDebug draws walkability, the latest search and every worshipper's path
+func (g *MikoGameWithWorshippers) drawPathDebug(screen *ebiten.Image) {
+	d := &g.pathDebug
+	if !d.Enabled {
+		return
+	}
+
+	tileSize := mikoTileSize * mikoScaleFactor
+
+	// Walkable and blocked tiles
+	for y := 0; y < mikoMapHeight; y++ {
+		for x := 0; x < mikoMapWidth; x++ {
+			clr := debugBlockedColor
+			if isWalkable(g.shrineMap, x, y) {
+				clr = debugWalkableColor
+			}
+			ebitenutil.DrawRect(screen, float64(x)*tileSize-g.cameraX+1, float64(y)*tileSize-g.cameraY+1,
+				tileSize-2, tileSize-2, clr)
+		}
+	}
+
+	// Open and closed sets of the most recent search
+	steps := len(d.trace.Steps)
+	if d.Stepping {
+		steps = d.Step
+	}
+	open, closed := d.trace.setsAt(steps)
+	for p := range closed {
+		ebitenutil.DrawRect(screen, float64(p.X)*tileSize-g.cameraX+8, float64(p.Y)*tileSize-g.cameraY+8,
+			tileSize-16, tileSize-16, debugClosedColor)
+	}
+	for p := range open {
+		ebitenutil.DrawRect(screen, float64(p.X)*tileSize-g.cameraX+8, float64(p.Y)*tileSize-g.cameraY+8,
+			tileSize-16, tileSize-16, debugOpenColor)
+	}
+	if steps == len(d.trace.Steps) {
+		g.drawDebugPath(screen, d.trace.Path, debugSearchColor)
+	}
+	for _, p := range []Point{d.trace.Start, d.trace.Goal} {
+		x, y := tileToPixel(p)
+		ebitenutil.DrawCircle(screen, x-g.cameraX, y-g.cameraY, 6, debugSearchColor)
+	}
+
+	// Each worshipper's remaining path and next target
+	for _, w := range g.worshippers.All() {
+		if w.PathIndex < len(w.Path) {
+			tx, ty := tileToPixel(w.NextTarget)
+			ebitenutil.DrawLine(screen, w.X-g.cameraX, w.Y-g.cameraY, tx-g.cameraX, ty-g.cameraY, debugPathColor)
+			g.drawDebugPath(screen, w.Path[w.PathIndex:], debugPathColor)
+			ebitenutil.DrawCircle(screen, tx-g.cameraX, ty-g.cameraY, 4, debugTargetColor)
+		}
+		ebitenutil.DrawCircle(screen, w.X-g.cameraX, w.Y-g.cameraY, 3, debugPathColor)
+		ebitenutil.DebugPrintAt(screen, fmt.Sprintf("%d/%d", w.PathIndex, len(w.Path)),
+			int(w.X-g.cameraX)+6, int(w.Y-g.cameraY)-16)
+	}
+
+	// Status panel in the bottom left corner
+	info := fmt.Sprintf("[経路デバッグ] 探索 (%d,%d)->(%d,%d) 展開 %d/%d 開 %d 閉 %d",
+		d.trace.Start.X, d.trace.Start.Y, d.trace.Goal.X, d.trace.Goal.Y,
+		steps, len(d.trace.Steps), len(open), len(closed))
+	if d.trace.Err != nil {
+		info += "\n" + d.trace.Err.Error()
+	}
+	key := g.input.Label
+	if d.Stepping {
+		info += fmt.Sprintf("\n[ステップ実行中] %s/%s: 探索を1手戻す/進める  %s: 1フレーム進める  %s: 再開",
+			key(InputDebugStepBack), key(InputDebugStepAhead), key(InputDebugAdvance), key(InputDebugStepping))
+	} else {
+		info += fmt.Sprintf("\n%s: ステップ実行  %s: デバッグ表示オフ", key(InputDebugStepping), key(InputPathDebug))
+	}
+	ebitenutil.DebugPrintAt(screen, info, 10, mikoScreenHeight-50)
+}
+
+// drawDebugPath draws a path as lines between tile centers
+func (g *MikoGameWithWorshippers) drawDebugPath(screen *ebiten.Image, path []Point, clr color.Color) {
+	for i := 0; i+1 < len(path); i++ {
+		ax, ay := tileToPixel(path[i])
+		bx, by := tileToPixel(path[i+1])
+		ebitenutil.DrawLine(screen, ax-g.cameraX, ay-g.cameraY, bx-g.cameraX, by-g.cameraY, clr)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"runtime"
+)
+
+// readDataFile reads a data file shipped next to the game. In the browser the
+// files are served alongside the wasm binary, so they are fetched instead.
+func readDataFile(path string) ([]byte, error) {
+	if runtime.GOOS != "js" {
+		return os.ReadFile(path)
+	}
+
+	res, err := http.Get(path)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching %s: %s", path, res.Status)
+	}
+	return io.ReadAll(res.Body)
+}
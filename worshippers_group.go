@@ -0,0 +1,303 @@
+package main
+
+import (
+	"math"
+
+	"EdomaeElf/behavior"
+)
+
+const (
+	// Visitor group constants
+	groupSpacing          = 28.0 // Distance between group members along the leader's trail
+	groupTrailStep        = 4.0  // The leader's trail gets a point every this many pixels
+	groupStraggleDistance = 96.0 // The leader waits while a follower is this far from their place
+	groupArriveDistance   = 24.0 // A follower this close to their place has caught up
+	groupCatchUp          = 1.3  // Followers walk at least this much faster than the group's pace
+	groupWaitFrames       = 1800 // Frames a member waits for the others at a stop before going on (30 seconds)
+)
+
+// GroupMember is a kind of companion a group leader brings along
+type GroupMember struct {
+	Archetype string   `json:"archetype"` // ID of the companions' archetype
+	Count     IntRange `json:"count"`     // How many of them come
+
+	archetype *Archetype
+}
+
+// GroupSpec describes the companions visitors of an archetype come with
+type GroupSpec struct {
+	Name    string        `json:"name"`   // Display name of such a group
+	Chance  float64       `json:"chance"` // Chance of coming with the group rather than alone
+	Members []GroupMember `json:"members"`
+}
+
+// VisitGroup is a party of worshippers visiting the shrine together. The
+// leader finds the way and the followers walk behind in the leader's
+// footsteps. Everyone waits for the others at each stop, so the group
+// purifies, prays and leaves together.
+type VisitGroup struct {
+	Name    string
+	Members []*Worshipper // Leader first, then the followers in formation order
+	Step    int           // Step of the visit the leader is heading to, see stepOf
+	trail   [][2]float64  // Positions the leader passed, oldest first
+}
+
+// spawnVisitors brings a visitor of the archetype onto the map, together
+// with their group if the archetype comes in groups, and returns everyone
+// who arrived
+func (g *MikoGameWithWorshippers) spawnVisitors(archetype *Archetype, env *WorshipperEnv) []*Worshipper {
+	g.nextWorshipperID++
+	leader := NewWorshipper(g.nextWorshipperID, archetype, env)
+	spec := archetype.Group
+	if spec == nil || g.rng.Float64() >= spec.Chance {
+		return []*Worshipper{leader}
+	}
+
+	// Groups keep to an itinerary, which the leader plans
+	if archetype.tree != nil {
+		leader.planVisit(env, false)
+	}
+	group := &VisitGroup{Name: spec.Name, Members: []*Worshipper{leader}}
+	for _, member := range spec.Members {
+		for n := member.Count.Draw(g.rng); n > 0; n-- {
+			g.nextWorshipperID++
+			group.Members = append(group.Members, NewWorshipper(g.nextWorshipperID, member.archetype, env))
+		}
+	}
+	if len(group.Members) == 1 {
+		return group.Members
+	}
+	group.form()
+	return group.Members
+}
+
+// form lines the followers up behind the leader. Everyone follows the
+// leader's itinerary, walks off the same side and waits in line as long as
+// the leader would. The leader keeps to the pace of the slowest member, and
+// followers walk faster so they can catch up.
+func (grp *VisitGroup) form() {
+	leader := grp.Members[0]
+	pace := leader.Speed
+	for _, w := range grp.Members {
+		pace = math.Min(pace, w.Speed)
+	}
+	leader.Speed = pace
+	direction := math.Copysign(1, leader.TargetX-leader.StartX)
+
+	for i, w := range grp.Members {
+		w.Group = grp
+		if i == 0 {
+			continue
+		}
+		w.X = leader.X - direction*float64(i)*groupSpacing
+		w.Y = leader.Y
+		w.StartX = w.X
+		w.TargetX = leader.TargetX
+		w.Speed = math.Max(w.Speed, pace*groupCatchUp)
+		w.Patience = leader.Patience
+		w.Itinerary = append([]VisitStop(nil), leader.Itinerary...)
+		w.Behavior = newVisitBehavior(w.Itinerary)
+	}
+
+	// The followers start on the trail, which leads up to the leader
+	for i := len(grp.Members) - 1; i >= 0; i-- {
+		grp.trail = append(grp.trail, [2]float64{grp.Members[i].X, grp.Members[i].Y})
+	}
+}
+
+// Leader returns the member who finds the way
+func (grp *VisitGroup) Leader() *Worshipper {
+	return grp.Members[0]
+}
+
+// indexOf returns the member's place in the formation, 0 for the leader
+func (grp *VisitGroup) indexOf(w *Worshipper) int {
+	for i, member := range grp.Members {
+		if member == w {
+			return i
+		}
+	}
+	return -1
+}
+
+// recordTrail adds the leader's position to the trail, keeping only as much
+// as the last follower needs
+func (grp *VisitGroup) recordTrail(x, y float64) {
+	if n := len(grp.trail); n > 0 && math.Hypot(x-grp.trail[n-1][0], y-grp.trail[n-1][1]) < groupTrailStep {
+		return
+	}
+	grp.trail = append(grp.trail, [2]float64{x, y})
+	if keep := int(float64(len(grp.Members))*groupSpacing/groupTrailStep) + 2; len(grp.trail) > keep {
+		grp.trail = append(grp.trail[:0], grp.trail[len(grp.trail)-keep:]...)
+	}
+}
+
+// formationSpot returns where the member at the given place walks: that many
+// spacings behind the leader along the leader's trail
+func (grp *VisitGroup) formationSpot(index int) (float64, float64) {
+	leader := grp.Leader()
+	remaining := float64(index) * groupSpacing
+	x, y := leader.X, leader.Y
+	for i := len(grp.trail) - 1; i >= 0; i-- {
+		px, py := grp.trail[i][0], grp.trail[i][1]
+		d := math.Hypot(px-x, py-y)
+		if d > 0 && d >= remaining {
+			t := remaining / d
+			return x + (px-x)*t, y + (py-y)*t
+		}
+		remaining -= d
+		x, y = px, py
+	}
+	return x, y
+}
+
+// straggling reports whether a follower on the move has fallen behind
+func (grp *VisitGroup) straggling() bool {
+	for i, w := range grp.Members {
+		if i == 0 || !w.Following {
+			continue
+		}
+		x, y := grp.formationSpot(i)
+		if math.Hypot(x-w.X, y-w.Y) > groupStraggleDistance {
+			return true
+		}
+	}
+	return false
+}
+
+// rowSize returns how many praying slots the group needs at once: one for
+// everyone who is still to pray, up to all of them
+func (grp *VisitGroup) rowSize() int {
+	n := 0
+	for _, w := range grp.Members {
+		if !w.Prayed && !w.GaveUp && w.Slot < 0 {
+			n++
+		}
+	}
+	return min(n, prayingSlotCount)
+}
+
+// groupAtBox reports whether another member of the worshipper's group holds a praying slot
+func (w *Worshipper) groupAtBox() bool {
+	if w.Group == nil {
+		return false
+	}
+	for _, member := range w.Group.Members {
+		if member != w && member.Slot >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// isFollower reports whether the worshipper walks behind a group leader
+func (w *Worshipper) isFollower() bool {
+	return w.Group != nil && w.Group.Leader() != w
+}
+
+// leaveGroup takes the worshipper out of their group, e.g. when they go home
+// early. The next member takes the lead, and a single member left over
+// carries on alone.
+func (w *Worshipper) leaveGroup() {
+	grp := w.Group
+	if grp == nil {
+		return
+	}
+	w.Group = nil
+	w.Following = false
+	i := grp.indexOf(w)
+	if i < 0 {
+		return
+	}
+	grp.Members = append(grp.Members[:i], grp.Members[i+1:]...)
+	if i == 0 {
+		// The new leader starts a trail of their own
+		grp.trail = grp.trail[:0]
+	}
+	if len(grp.Members) == 1 {
+		grp.Members[0].Group = nil
+		grp.Members = nil
+	}
+}
+
+// stepOf returns the step of the visit a target belongs to: its place in the
+// itinerary, then the exit and off-screen
+func (w *Worshipper) stepOf(target string) int {
+	switch target {
+	case targetExit:
+		return len(w.Itinerary)
+	case targetOffscreen:
+		return len(w.Itinerary) + 1
+	}
+	for i := range w.Itinerary {
+		if w.Itinerary[i].Target == target {
+			return i
+		}
+	}
+	return -1
+}
+
+// gather records that the worshipper has reached the target and reports
+// whether the rest of the group has too. Members who keep the others waiting
+// too long are left to catch up.
+func (w *Worshipper) gather(target string) bool {
+	if w.Reached != target {
+		w.Reached = target
+		w.GroupWait = 0
+	}
+	if w.Group == nil {
+		return true
+	}
+	w.GroupWait++
+	if w.GroupWait >= groupWaitFrames {
+		return true
+	}
+	for _, member := range w.Group.Members {
+		if member.Reached != target {
+			return false
+		}
+	}
+	return true
+}
+
+// follow walks a follower to their place behind the leader and succeeds
+// once the group has gathered at the target. It fails if the leader skipped
+// the target.
+func (a *worshipperAgent) follow(target string, frame int) behavior.Status {
+	w := a.w
+	grp := w.Group
+	if grp.Step > w.stepOf(target) {
+		w.Following = false
+		return behavior.Failure
+	}
+	if frame == 0 {
+		if target == targetExit {
+			w.Stop = nil
+			w.State = StateLeaving
+		} else {
+			w.Stop = w.stopFor(target)
+			w.State = StateWalking
+		}
+		w.Timer = 0
+		w.Following = true
+	}
+
+	x, y := grp.formationSpot(grp.indexOf(w))
+	w.moveToSpot(x, y)
+	if grp.Leader().Reached != target || math.Hypot(x-w.X, y-w.Y) >= groupArriveDistance || !w.gather(target) {
+		return behavior.Running
+	}
+	w.Following = false
+	return behavior.Success
+}
+
+// groupCount returns the number of groups on the map and their members
+func (g *MikoGameWithWorshippers) groupCount() (groups, members int) {
+	for _, w := range g.worshippers.All() {
+		if w.Group != nil && w.Group.Leader() == w {
+			groups++
+			members += len(w.Group.Members)
+		}
+	}
+	return groups, members
+}
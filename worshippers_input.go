@@ -0,0 +1,148 @@
+package main
+
+import (
+	"errors"
+
+	"github.com/hajimehoshi/ebiten/v2"
+
+	"EdomaeElf/input"
+	"EdomaeElf/storage"
+)
+
+const (
+	inputFile     = "assets/data/input.json" // Bindings the game ships with
+	inputSaveName = "worshippers_input.json" // Bindings the player changed on the rebinding screen
+)
+
+// InputAction is something the player can do, whatever it is bound to
+type InputAction = input.Action
+
+const (
+	InputMoveUp InputAction = iota
+	InputMoveDown
+	InputMoveLeft
+	InputMoveRight
+	InputInteract // Talk to the nearest visitor, or close the menu
+	InputCancel   // Close the menu
+	InputChoice1  // Menu entries
+	InputChoice2
+	InputChoice3
+	InputChoice4
+	InputChore        // Do the chore nearby
+	InputToggleEditor // Switch between playing and editing the map
+	InputCameraReset  // Move the editor's camera back to the corner
+	InputTilePrevX    // Pick the tile to place in the editor
+	InputTileNextX
+	InputTilePrevY
+	InputTileNextY
+	InputSlower
+	InputFaster
+	InputExportLedger
+	InputVisitorBook
+	InputPageUp
+	InputPageDown
+	InputPathDebug
+	InputDebugStepping  // Pause the simulation to step through searches
+	InputDebugStepBack  // Show one expansion less of the latest search
+	InputDebugStepAhead // Show one expansion more
+	InputDebugAdvance   // Run the paused simulation for a frame
+	InputBindings       // Open the rebinding screen
+)
+
+// inputActionCount is the number of actions
+const inputActionCount = int(InputBindings) + 1
+
+// inputActions names the actions in the config file and on the rebinding
+// screen, in order
+var inputActions = []input.ActionInfo{
+	InputMoveUp:         {ID: "moveUp", Label: "上へ移動"},
+	InputMoveDown:       {ID: "moveDown", Label: "下へ移動"},
+	InputMoveLeft:       {ID: "moveLeft", Label: "左へ移動"},
+	InputMoveRight:      {ID: "moveRight", Label: "右へ移動"},
+	InputInteract:       {ID: "interact", Label: "話しかける"},
+	InputCancel:         {ID: "cancel", Label: "閉じる"},
+	InputChoice1:        {ID: "choice1", Label: "メニュー1"},
+	InputChoice2:        {ID: "choice2", Label: "メニュー2"},
+	InputChoice3:        {ID: "choice3", Label: "メニュー3"},
+	InputChoice4:        {ID: "choice4", Label: "メニュー4"},
+	InputChore:          {ID: "chore", Label: "お勤め"},
+	InputToggleEditor:   {ID: "toggleEditor", Label: "編集モード切替"},
+	InputCameraReset:    {ID: "cameraReset", Label: "カメラリセット"},
+	InputTilePrevX:      {ID: "tilePrevX", Label: "タイルX-"},
+	InputTileNextX:      {ID: "tileNextX", Label: "タイルX+"},
+	InputTilePrevY:      {ID: "tilePrevY", Label: "タイルY-"},
+	InputTileNextY:      {ID: "tileNextY", Label: "タイルY+"},
+	InputSlower:         {ID: "slower", Label: "ゲーム速度-"},
+	InputFaster:         {ID: "faster", Label: "ゲーム速度+"},
+	InputExportLedger:   {ID: "exportLedger", Label: "賽銭帳の書き出し"},
+	InputVisitorBook:    {ID: "visitorBook", Label: "参拝者名簿"},
+	InputPageUp:         {ID: "pageUp", Label: "前のページ"},
+	InputPageDown:       {ID: "pageDown", Label: "次のページ"},
+	InputPathDebug:      {ID: "pathDebug", Label: "経路デバッグ表示"},
+	InputDebugStepping:  {ID: "debugStepping", Label: "ステップ実行"},
+	InputDebugStepBack:  {ID: "debugStepBack", Label: "探索を1手戻す"},
+	InputDebugStepAhead: {ID: "debugStepAhead", Label: "探索を1手進める"},
+	InputDebugAdvance:   {ID: "debugAdvance", Label: "1フレーム進める"},
+	InputBindings:       {ID: "bindings", Label: "操作設定"},
+}
+
+// defaultBindings are the bindings used for actions the config file leaves
+// out, and when there is no config file
+func defaultBindings() [][]input.Binding {
+	key, pad, stick := input.Key, input.Pad, input.StickDirection
+	vertical, horizontal := ebiten.StandardGamepadAxisLeftStickVertical, ebiten.StandardGamepadAxisLeftStickHorizontal
+
+	b := make([][]input.Binding, inputActionCount)
+	b[InputMoveUp] = []input.Binding{key(ebiten.KeyW), key(ebiten.KeyArrowUp), pad(ebiten.StandardGamepadButtonLeftTop), stick(vertical, -1)}
+	b[InputMoveDown] = []input.Binding{key(ebiten.KeyS), key(ebiten.KeyArrowDown), pad(ebiten.StandardGamepadButtonLeftBottom), stick(vertical, 1)}
+	b[InputMoveLeft] = []input.Binding{key(ebiten.KeyA), key(ebiten.KeyArrowLeft), pad(ebiten.StandardGamepadButtonLeftLeft), stick(horizontal, -1)}
+	b[InputMoveRight] = []input.Binding{key(ebiten.KeyD), key(ebiten.KeyArrowRight), pad(ebiten.StandardGamepadButtonLeftRight), stick(horizontal, 1)}
+	b[InputInteract] = []input.Binding{key(ebiten.KeySpace), pad(ebiten.StandardGamepadButtonRightBottom)}
+	b[InputCancel] = []input.Binding{key(ebiten.KeyEscape), pad(ebiten.StandardGamepadButtonRightRight)}
+	b[InputChoice1] = []input.Binding{key(ebiten.Key1), pad(ebiten.StandardGamepadButtonRightLeft)}
+	b[InputChoice2] = []input.Binding{key(ebiten.Key2), pad(ebiten.StandardGamepadButtonRightTop)}
+	b[InputChoice3] = []input.Binding{key(ebiten.Key3), pad(ebiten.StandardGamepadButtonFrontTopLeft)}
+	b[InputChoice4] = []input.Binding{key(ebiten.Key4), pad(ebiten.StandardGamepadButtonFrontTopRight)}
+	b[InputChore] = []input.Binding{key(ebiten.KeyF), pad(ebiten.StandardGamepadButtonFrontBottomRight)}
+	b[InputToggleEditor] = []input.Binding{key(ebiten.KeyE), pad(ebiten.StandardGamepadButtonCenterLeft)}
+	b[InputCameraReset] = []input.Binding{key(ebiten.KeyHome)}
+	b[InputTilePrevX] = []input.Binding{key(ebiten.KeyQ)}
+	b[InputTileNextX] = []input.Binding{key(ebiten.KeyR)}
+	b[InputTilePrevY] = []input.Binding{key(ebiten.KeyT)}
+	b[InputTileNextY] = []input.Binding{key(ebiten.KeyY)}
+	b[InputSlower] = []input.Binding{key(ebiten.KeyMinus)}
+	b[InputFaster] = []input.Binding{key(ebiten.KeyEqual)}
+	b[InputExportLedger] = []input.Binding{key(ebiten.KeyL)}
+	b[InputVisitorBook] = []input.Binding{key(ebiten.KeyB), pad(ebiten.StandardGamepadButtonCenterRight)}
+	b[InputPageUp] = []input.Binding{key(ebiten.KeyPageUp)}
+	b[InputPageDown] = []input.Binding{key(ebiten.KeyPageDown)}
+	b[InputPathDebug] = []input.Binding{key(ebiten.KeyP)}
+	b[InputDebugStepping] = []input.Binding{key(ebiten.KeyO)}
+	b[InputDebugStepBack] = []input.Binding{key(ebiten.KeyBracketLeft)}
+	b[InputDebugStepAhead] = []input.Binding{key(ebiten.KeyBracketRight)}
+	b[InputDebugAdvance] = []input.Binding{key(ebiten.KeyPeriod)}
+	b[InputBindings] = []input.Binding{key(ebiten.KeyF1), pad(ebiten.StandardGamepadButtonLeftStick)}
+	return b
+}
+
+// loadBindings reads the bindings the player saved on the rebinding screen,
+// or else the config file shipped with the game
+func loadBindings(m *input.Map) error {
+	data, err := storage.Load(inputSaveName)
+	if errors.Is(err, storage.ErrNotFound) {
+		data, err = readDataFile(inputFile)
+	}
+	if err != nil {
+		return err
+	}
+	return m.Load(data)
+}
+
+// saveBindings stores the bindings the player changed on the rebinding screen
+func saveBindings(m *input.Map) error {
+	data, err := m.Marshal()
+	if err != nil {
+		return err
+	}
+	return storage.Save(inputSaveName, data)
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// Player interaction constants
+	interactRange     = 96.0  // Distance in pixels within which the miko can talk to a visitor
+	interactKeepRange = 144.0 // The menu closes once the visitor is further away than this
+	noticeFrames      = 180   // Frames a notice stays in the HUD (3 seconds)
+	directionsMood    = 0.1   // Mood gained from being shown the way
+	charmPrice        = 500   // Yen an omamori sells for
+	charmBoughtMood   = 0.05  // Mood gained from buying an omamori
+	charmDeclinedMood = 0.05  // Mood lost to a sales pitch the visitor turned down
+	cutInMood         = 0.05  // Mood lost by each visitor someone pushes in front of
+	scoldMood         = 0.2   // Mood lost by a visitor told off for cutting in
+	scoldThanksMood   = 0.05  // Mood gained by the visitors the miko stood up for
+)
+
+// Interaction is something the miko can do for or to a worshipper
+type Interaction int
+
+const (
+	InteractGreet      Interaction = iota // Say hello
+	InteractDirections                    // Show the way, which sets a lost visitor on to the next stop
+	InteractSellCharm                     // Offer an omamori
+	InteractScold                         // Send a visitor who cut in line to the back
+)
+
+// interactionNames are the menu entries of the interactions
+var interactionNames = [...]string{
+	InteractGreet:      "あいさつする",
+	InteractDirections: "道案内する",
+	InteractSellCharm:  "お守りを勧める",
+	InteractScold:      "割り込みを注意する",
+}
+
+// interactionChoices pick the menu entries in order
+var interactionChoices = []InputAction{InputChoice1, InputChoice2, InputChoice3, InputChoice4}
+
+// InteractionMenu is the list of things the miko can do for the visitor
+// being talked to
+type InteractionMenu struct {
+	Target  *Worshipper   // Visitor the menu is open for, nil if closed
+	Options []Interaction // Interactions available for the target
+}
+
+// notify shows a message in the HUD for a few seconds
+func (g *MikoGameWithWorshippers) notify(message string) {
+	g.notice = message
+	g.noticeFrames = noticeFrames
+}
+
+// cutInLine pushes the worshipper to the head of the line, annoying everyone passed
+func (w *Worshipper) cutInLine(queue *DonationQueue) {
+	passed := queue.CutIn(w)
+	for _, other := range passed {
+		other.changeMood(-cutInMood)
+	}
+	if len(passed) > 0 {
+		w.CutIn = true
+	}
+}
+
+// availableInteractions returns what the miko can do for the worshipper now
+func availableInteractions(w *Worshipper, options []Interaction) []Interaction {
+	options = options[:0]
+	if !w.Greeted {
+		options = append(options, InteractGreet)
+	}
+	if !w.Helped && (w.State == StateWalking || (w.State == StateConfused && w.ResumeState == StateWalking)) {
+		options = append(options, InteractDirections)
+	}
+	if !w.OfferedCharm {
+		options = append(options, InteractSellCharm)
+	}
+	if w.CutIn && w.State == StateQueueing {
+		options = append(options, InteractScold)
+	}
+	return options
+}
+
+// nearestWorshipper returns the visitor closest to the miko within the given
+// range, nil if there is none
+func (g *MikoGameWithWorshippers) nearestWorshipper(maxDistance float64) *Worshipper {
+	var nearest *Worshipper
+	for _, w := range g.worshippers.All() {
+		if w.State == StateLeaving {
+			continue
+		}
+		if d := g.distanceToPlayer(w); d < maxDistance {
+			nearest, maxDistance = w, d
+		}
+	}
+	return nearest
+}
+
+// distanceToPlayer returns the distance between the centers of the worshipper and the miko
+func (g *MikoGameWithWorshippers) distanceToPlayer(w *Worshipper) float64 {
+	px, py := playerCenter(g.player)
+	cx, cy := worshipperCenter(w)
+	return math.Hypot(cx-px, cy-py)
+}
+
+// updateInteraction opens the menu for the nearest visitor and carries out
+// the entry picked
+func (g *MikoGameWithWorshippers) updateInteraction() {
+	menu := &g.interaction
+	if menu.Target != nil && (menu.Target.State == StateLeaving || g.distanceToPlayer(menu.Target) > interactKeepRange) {
+		menu.Target = nil
+	}
+
+	switch {
+	case g.input.JustPressed(InputInteract):
+		if menu.Target != nil {
+			menu.Target = nil
+		} else {
+			menu.Target = g.nearestWorshipper(interactRange)
+		}
+	case g.input.JustPressed(InputCancel):
+		menu.Target = nil
+	}
+	if menu.Target == nil {
+		return
+	}
+
+	menu.Options = availableInteractions(menu.Target, menu.Options)
+	for i, choice := range interactionChoices {
+		if i < len(menu.Options) && g.input.JustPressed(choice) {
+			g.interact(menu.Target, menu.Options[i])
+			menu.Target = nil
+			return
+		}
+	}
+}
+
+// interact carries out an interaction and shows how the visitor took it
+func (g *MikoGameWithWorshippers) interact(w *Worshipper, interaction Interaction) {
+	name := w.displayName()
+
+	var feedback string
+	switch interaction {
+	case InteractGreet:
+		w.Greeted = true
+		w.changeMood(greetMood)
+		g.speech.Say(w, SpeechGreeted)
+		feedback = fmt.Sprintf("%sにあいさつした", name)
+
+	case InteractDirections:
+		w.Helped = true
+		w.changeMood(directionsMood)
+		if w.State == StateConfused {
+			// Stop searching for the unreachable stop and move on to the next
+			w.ConfusedTimer = confusedGiveUpFrames - 1
+		}
+		g.speech.Say(w, SpeechDirections)
+		feedback = fmt.Sprintf("%sに道を案内した", name)
+
+	case InteractSellCharm:
+		// Nothing to offer until the stall is restocked
+		if g.chores.Empty(ChoreCharms) {
+			feedback = "お守りが売り切れている (授与所に補充が必要)"
+			break
+		}
+		w.OfferedCharm = true
+		// Happy visitors are more likely to buy
+		if g.playerRng.Float64() < w.Mood {
+			g.chores.Use(ChoreCharms, 1.0/charmStock)
+			w.changeMood(charmBoughtMood)
+			g.charmsSold++
+			g.charmYen += charmPrice
+			g.speech.Say(w, SpeechCharmBought)
+			feedback = fmt.Sprintf("%sがお守りを買った (+%d円)", name, charmPrice)
+		} else {
+			w.changeMood(-charmDeclinedMood)
+			g.speech.Say(w, SpeechCharmDeclined)
+			feedback = fmt.Sprintf("%sはお守りを買わなかった", name)
+		}
+
+	case InteractScold:
+		w.CutIn = false
+		w.changeMood(-scoldMood)
+		g.donationQueue.SendToBack(w)
+		for _, other := range g.worshippers.All() {
+			if other != w && other.State == StateQueueing {
+				other.changeMood(scoldThanksMood)
+			}
+		}
+		g.speech.Say(w, SpeechScolded)
+		feedback = fmt.Sprintf("割り込んだ%sを列の後ろに並ばせた", name)
+	}
+
+	g.notify("巫女: " + feedback)
+}
+
+// interactionHUD returns the HUD lines of the interaction menu
+func (g *MikoGameWithWorshippers) interactionHUD() string {
+	menu := &g.interaction
+	var hud string
+	if menu.Target != nil {
+		name := menu.Target.displayName()
+		if regular := menu.Target.Regular; regular != nil {
+			name += fmt.Sprintf(" (常連・%d回目)", regular.Visits+1)
+		}
+		hud += fmt.Sprintf("\n[%s  機嫌: %.0f%%]\n", name, menu.Target.Mood*100)
+		if len(menu.Options) == 0 {
+			hud += "特にすることはない\n"
+		}
+		for i, option := range menu.Options {
+			hud += fmt.Sprintf("%s: %s\n", g.input.Label(interactionChoices[i]), interactionNames[option])
+		}
+		hud += fmt.Sprintf("%s/%s: 閉じる\n", g.input.Label(InputInteract), g.input.Label(InputCancel))
+	}
+	return hud
+}
+
+// drawInteractionTarget marks the feet of the visitor the miko is talking
+// to, or of the one the interact action would talk to
+func (g *MikoGameWithWorshippers) drawInteractionTarget(screen *ebiten.Image) {
+	if g.editMode {
+		return
+	}
+	target := g.interaction.Target
+	mark := color.RGBA{255, 220, 0, 220}
+	if target == nil {
+		if action, _ := g.facedTileAction(); action != nil || g.player.Inside {
+			// The interact action uses the tile instead
+			return
+		}
+		target = g.nearestWorshipper(interactRange)
+		mark = color.RGBA{255, 255, 255, 120}
+	}
+	if target == nil {
+		return
+	}
+	cx, cy := worshipperCenter(target)
+	size := spriteSize(target.Image, target.Scale)
+	x, y := cx-g.cameraX, cy-g.cameraY+size/2
+	ebitenutil.DrawRect(screen, x-size/2, y-2, size, 4, mark)
+}
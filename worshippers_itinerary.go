@@ -0,0 +1,214 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"math/rand"
+	"slices"
+
+	"EdomaeElf/behavior"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// Visit itinerary constants
+	toriiBowDuration      = 40  // Frames spent bowing at the torii
+	purifyDuration        = 150 // Frames spent purifying hands at the temizuya
+	admireDuration        = 180 // Frames spent paying respects to the sacred tree
+	sacredTreeVisitChance = 0.4 // Chance that a default visitor also visits the sacred tree
+)
+
+// Targets a worshipper's behavior can move to
+const (
+	targetTorii      = "torii"
+	targetTemizuya   = "temizuya"
+	targetOffering   = "offering"
+	targetSacredTree = "sacredTree"
+	targetExit       = "exit"      // Walkable tile the worshipper leaves the map from
+	targetOffscreen  = "offscreen" // Past the edge of the map, never reached
+)
+
+// Landmarks the stops of a visit are built around
+var (
+	toriiTile      = Point{8, 10} // Right half of the torii, over the sando
+	temizuyaTile   = Point{5, 6}
+	sacredTreeTile = Point{3, 3}
+)
+
+// StopAction is what a visitor does at a stop
+type StopAction int
+
+const (
+	ActionBow    StopAction = iota // Bow before passing the torii
+	ActionPurify                   // Rinse hands at the temizuya
+	ActionPray                     // Offer money and pray at the donation box
+	ActionAdmire                   // Pay respects to the sacred tree
+)
+
+// stopActionNames are the names behaviors use for the actions
+var stopActionNames = map[StopAction]string{
+	ActionBow:    "bow",
+	ActionPurify: "purify",
+	ActionPray:   "pray",
+	ActionAdmire: "admire",
+}
+
+// String returns the name behaviors use for the action
+func (a StopAction) String() string {
+	return stopActionNames[a]
+}
+
+// stopActionByName looks up an action by its name
+func stopActionByName(name string) (StopAction, bool) {
+	for action, actionName := range stopActionNames {
+		if actionName == name {
+			return action, true
+		}
+	}
+	return 0, false
+}
+
+// defaultDuration returns how long an action takes when no stop says otherwise
+func defaultDuration(action StopAction) int {
+	switch action {
+	case ActionBow:
+		return toriiBowDuration
+	case ActionPurify:
+		return purifyDuration
+	case ActionPray:
+		return offeringDuration
+	case ActionAdmire:
+		return admireDuration
+	}
+	return 0
+}
+
+// VisitStop is one stop of a visitor's itinerary
+type VisitStop struct {
+	Target   string // Name behaviors move to
+	Action   StopAction
+	Tile     Point // Walkable tile the visitor stands on
+	Duration int   // Frames spent performing the action
+}
+
+// standTile returns the walkable tile a visitor stands on to face a landmark,
+// preferring the tile in front of (below) it
+func standTile(shrineMap [][]TileID, landmark Point) (Point, error) {
+	for _, d := range []Point{{0, 1}, {-1, 0}, {1, 0}, {0, -1}} {
+		p := Point{landmark.X + d.X, landmark.Y + d.Y}
+		if isWalkable(shrineMap, p.X, p.Y) {
+			return p, nil
+		}
+	}
+	return Point{}, fmt.Errorf("no walkable tile next to landmark (%d, %d)", landmark.X, landmark.Y)
+}
+
+// newItinerary plans a visit: bow at the torii, purify at the temizuya, pray
+// at the donation box and visit the sacred tree on the way out. Every stop but
+// praying is optional and included with the chance given in prefs. Stops whose
+// landmark cannot be reached on the current map are left out.
+func newItinerary(rng *rand.Rand, shrineMap [][]TileID, prefs StopPreferences) []VisitStop {
+	var stops []VisitStop
+	addStop := func(target string, chance float64) {
+		if rng.Float64() >= chance {
+			return
+		}
+		if stop, ok := stopAt(shrineMap, target); ok {
+			stops = append(stops, stop)
+		}
+	}
+
+	addStop(targetTorii, prefs.Bow)
+	addStop(targetTemizuya, prefs.Purify)
+	addStop(targetOffering, 1)
+	addStop(targetSacredTree, prefs.Admire)
+	return stops
+}
+
+// treeItinerary plans the stops a behavior tree from data moves to, in the
+// order the tree first names them. Targets whose landmark cannot be reached
+// are left out, and moving to them fails.
+func treeItinerary(shrineMap [][]TileID, spec behavior.Spec) []VisitStop {
+	var stops []VisitStop
+	var visit func(spec behavior.Spec)
+	visit = func(spec behavior.Spec) {
+		if spec.Type == "moveTo" && !slices.ContainsFunc(stops, func(s VisitStop) bool { return s.Target == spec.Target }) {
+			if stop, ok := stopAt(shrineMap, spec.Target); ok {
+				stops = append(stops, stop)
+			}
+		}
+		for _, child := range spec.Children {
+			visit(child)
+		}
+	}
+	visit(spec)
+	return stops
+}
+
+// stopAt returns the stop at the landmark of a target. It reports false
+// when the landmark cannot be reached on the current map.
+func stopAt(shrineMap [][]TileID, target string) (VisitStop, bool) {
+	var action StopAction
+	var landmark Point
+	var duration int
+	switch target {
+	case targetTorii:
+		action, landmark, duration = ActionBow, toriiTile, toriiBowDuration
+	case targetTemizuya:
+		action, landmark, duration = ActionPurify, temizuyaTile, purifyDuration
+	case targetOffering:
+		// Praying has its own slots in front of the box
+		return VisitStop{Target: targetOffering, Action: ActionPray, Tile: prayingTile, Duration: offeringDuration}, true
+	case targetSacredTree:
+		action, landmark, duration = ActionAdmire, sacredTreeTile, admireDuration
+	default:
+		log.Printf("Warning: Skipping stop: unknown target %q", target)
+		return VisitStop{}, false
+	}
+	tile, err := standTile(shrineMap, landmark)
+	if err != nil {
+		log.Printf("Warning: Skipping stop: %v", err)
+		return VisitStop{}, false
+	}
+	return VisitStop{Target: target, Action: action, Tile: tile, Duration: duration}, true
+}
+
+// CurrentStop returns the stop the worshipper is heading to or visiting,
+// nil when it is not at or on the way to a stop
+func (w *Worshipper) CurrentStop() *VisitStop {
+	return w.Stop
+}
+
+// stopFor returns the stop of the itinerary with the given target, if any
+func (w *Worshipper) stopFor(target string) *VisitStop {
+	for i := range w.Itinerary {
+		if w.Itinerary[i].Target == target {
+			return &w.Itinerary[i]
+		}
+	}
+	return nil
+}
+
+// atStopTile reports whether the worshipper stands on the tile of the
+// current stop on the last leg of its path. Visitors crowding a landmark
+// perform their action anywhere on the tile; praying has its own slots.
+func (w *Worshipper) atStopTile() bool {
+	stop := w.CurrentStop()
+	return stop != nil && stop.Action != ActionPray && len(w.Path) > 0 && w.PathIndex+1 >= len(w.Path) &&
+		pixelToTile(w.X, w.Y) == stop.Tile
+}
+
+// drawVisitEffect draws splashing water for worshippers at the temizuya
+func (g *MikoGameWithWorshippers) drawVisitEffect(screen *ebiten.Image, w *Worshipper) {
+	stop := w.CurrentStop()
+	if w.State != StateVisiting || stop == nil || stop.Action != ActionPurify {
+		return
+	}
+	size := spriteSize(w.Image, w.Scale)
+	x := w.X - g.cameraX + size/2
+	y := w.Y - g.cameraY + size/2 + float64(w.Timer%20)
+	ebitenutil.DrawCircle(screen, x, y, 2, color.RGBA{120, 180, 255, 220})
+}
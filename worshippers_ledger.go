@@ -0,0 +1,237 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"slices"
+	"strconv"
+	"time"
+
+	"EdomaeElf/storage"
+)
+
+const (
+	// Ledger constants
+	ledgerTimeLayout   = "2006-01-02 15:04:05" // Format of the timestamps in the CSV export
+	ledgerExportLayout = "20060102_1504"       // Date part of the export's file name
+)
+
+// yenDenominations are the Japanese coins and bills, smallest first
+var yenDenominations = []int{1, 5, 10, 50, 100, 500, 1000, 5000, 10000}
+
+// nextDenomination returns the coin or bill steps denominations away from
+// the given amount, staying within the smallest and the largest
+func nextDenomination(yen, steps int) int {
+	i := 0
+	for i+1 < len(yenDenominations) && yenDenominations[i+1] <= yen {
+		i++
+	}
+	i += steps
+	if i < 0 {
+		i = 0
+	}
+	if i >= len(yenDenominations) {
+		i = len(yenDenominations) - 1
+	}
+	return yenDenominations[i]
+}
+
+// LedgerEntry is an offering made at the donation box
+type LedgerEntry struct {
+	Time      time.Time `json:"time"` // In-game time of the offering
+	VisitorID int       `json:"visitor"`
+	Archetype string    `json:"archetype"` // ID of the visitor's archetype
+	Yen       int       `json:"yen"`
+}
+
+// LedgerDay is the total of a day's offerings, kept instead of the offerings
+// themselves once they are old enough
+type LedgerDay struct {
+	Date  time.Time `json:"date"`  // Midnight at the start of the day
+	Count int       `json:"count"` // Offerings made that day
+	Yen   int       `json:"yen"`
+}
+
+// Ledger records every offering in the order they were made. Older ones are
+// rolled up into per-day totals by Compact.
+type Ledger struct {
+	Days    []LedgerDay   // Per-day totals of the rolled up offerings, oldest first
+	Entries []LedgerEntry // Offerings made since, one by one
+	rolled  int           // Offerings in Days
+	total   int
+}
+
+// NewLedger returns a ledger holding the given days and entries, e.g. from a save
+func NewLedger(days []LedgerDay, entries []LedgerEntry) Ledger {
+	l := Ledger{Days: days, Entries: entries}
+	for _, d := range days {
+		l.rolled += d.Count
+		l.total += d.Yen
+	}
+	for _, e := range entries {
+		l.total += e.Yen
+	}
+	return l
+}
+
+// Add records an offering
+func (l *Ledger) Add(entry LedgerEntry) {
+	l.Entries = append(l.Entries, entry)
+	l.total += entry.Yen
+}
+
+// Len returns the number of offerings made, rolled up ones included
+func (l *Ledger) Len() int {
+	return l.rolled + len(l.Entries)
+}
+
+// Total returns the yen offered since the ledger was started
+func (l *Ledger) Total() int {
+	return l.total
+}
+
+// Since returns the yen offered from the given time on. Entries are in time
+// order, so only the recent ones are visited. A rolled up day counts if it
+// starts at or after the given time.
+func (l *Ledger) Since(start time.Time) int {
+	yen := 0
+	for i := len(l.Entries) - 1; i >= 0 && !l.Entries[i].Time.Before(start); i-- {
+		yen += l.Entries[i].Yen
+	}
+	for i := len(l.Days) - 1; i >= 0 && !l.Days[i].Date.Before(start); i-- {
+		yen += l.Days[i].Yen
+	}
+	return yen
+}
+
+// After returns the yen offered in the offerings after the first n. Rolled up
+// offerings are always among the first n, see Compact.
+func (l *Ledger) After(n int) int {
+	yen := 0
+	for _, entry := range l.Entries[min(max(n-l.rolled, 0), len(l.Entries)):] {
+		yen += entry.Yen
+	}
+	return yen
+}
+
+// Compact rolls the offerings made before the given time into per-day
+// totals, but only from the first n, so that After stays exact for n
+func (l *Ledger) Compact(before time.Time, n int) {
+	k := 0
+	for k < min(n-l.rolled, len(l.Entries)) && l.Entries[k].Time.Before(before) {
+		k++
+	}
+	if k == 0 {
+		return
+	}
+	for _, e := range l.Entries[:k] {
+		date := startOfDay(e.Time)
+		if last := len(l.Days) - 1; last >= 0 && l.Days[last].Date.Equal(date) {
+			l.Days[last].Count++
+			l.Days[last].Yen += e.Yen
+			continue
+		}
+		l.Days = append(l.Days, LedgerDay{Date: date, Count: 1, Yen: e.Yen})
+	}
+	l.Entries = slices.Clone(l.Entries[k:])
+	l.rolled += k
+}
+
+// startOfDay returns midnight at the start of t's day
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
+
+// startOfWeek returns midnight at the start of the Monday of t's week
+func startOfWeek(t time.Time) time.Time {
+	daysSinceMonday := (int(t.Weekday()) + 6) % 7
+	return startOfDay(t).AddDate(0, 0, -daysSinceMonday)
+}
+
+// CSV returns the ledger as CSV with a header row. Rolled up days come first,
+// as rows without a visitor that count all of the day's offerings.
+func (l *Ledger) CSV() ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"time", "visitor_id", "archetype", "yen", "count"})
+	for _, d := range l.Days {
+		w.Write([]string{
+			d.Date.Format(ledgerTimeLayout),
+			"",
+			"",
+			strconv.Itoa(d.Yen),
+			strconv.Itoa(d.Count),
+		})
+	}
+	for _, e := range l.Entries {
+		w.Write([]string{
+			e.Time.Format(ledgerTimeLayout),
+			strconv.Itoa(e.VisitorID),
+			e.Archetype,
+			strconv.Itoa(e.Yen),
+			"1",
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// recordOffering settles the worshipper's offering and enters it in the ledger
+func (g *MikoGameWithWorshippers) recordOffering(w *Worshipper) {
+	archetype := ""
+	if w.Archetype != nil {
+		archetype = w.Archetype.ID
+	}
+	g.ledger.Add(LedgerEntry{
+		Time:      g.clock.Time,
+		VisitorID: w.ID,
+		Archetype: archetype,
+		Yen:       w.offer(),
+	})
+}
+
+// compactLedger rolls up the offerings the save no longer needs one by one.
+// This week's stay for the HUD, the session's stay for a replay to make them
+// again, and so do those not yet collected from the donation box.
+func (g *MikoGameWithWorshippers) compactLedger() {
+	before := startOfWeek(g.clock.Time)
+	if g.saveData.StartClock.Before(before) {
+		before = g.saveData.StartClock
+	}
+	g.ledger.Compact(before, g.saveData.StartBoxCollected)
+}
+
+// updateLedgerExport writes the ledger to a CSV file when asked to
+func (g *MikoGameWithWorshippers) updateLedgerExport() {
+	if !g.input.JustPressed(InputExportLedger) {
+		return
+	}
+	path, err := g.exportLedger()
+	if err != nil {
+		log.Printf("Warning: Could not export the ledger: %v", err)
+		g.notify("賽銭帳を書き出せなかった")
+		return
+	}
+	log.Printf("Exported %d offerings to %s", g.ledger.Len(), path)
+	g.notify("賽銭帳を書き出した: " + path)
+}
+
+// exportLedger hands the ledger to the player as a CSV file named after the
+// in-game time and returns where it went
+func (g *MikoGameWithWorshippers) exportLedger() (string, error) {
+	data, err := g.ledger.CSV()
+	if err != nil {
+		return "", err
+	}
+	name := fmt.Sprintf("saisen_%s.csv", g.clock.Time.Format(ledgerExportLayout))
+	return storage.Export(name, data)
+}
+
+// ledgerHUD returns the HUD line with the day's, week's and all-time offerings
+func (g *MikoGameWithWorshippers) ledgerHUD() string {
+	now := g.clock.Time
+	return fmt.Sprintf("賽銭: 今日 %d円 / 今週 %d円 / 累計 %d円 (%d件)\n",
+		g.ledger.Since(startOfDay(now)), g.ledger.Since(startOfWeek(now)), g.ledger.Total(), g.ledger.Len())
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// Visitor mood constants. Mood runs from 0 (furious) to 1 (delighted) and
+	// the changes are per simulation tick.
+	moodStart         = 0.6     // Mood of a visitor arriving at the shrine
+	crowdRadius       = 64.0    // Other visitors closer than this count as a crowd
+	crowdComfort      = 2       // Neighbors a visitor puts up with before minding the crowd
+	crowdCountTicks   = 4       // Visitors count the crowd around them this often, in turn
+	crowdMoodPerTick  = 0.00005 // Mood lost per neighbor over the comfortable number
+	queueMoodPerTick  = 0.0001  // Mood lost while waiting in line
+	dirtMoodPerTick   = 0.0002  // Mood lost at a completely dirty shrine, less when cleaner
+	cleanMoodAbove    = 0.8     // Cleanliness above which the grounds please visitors
+	cleanMoodPerTick  = 0.00005 // Mood gained at a spotless shrine
+	hourMoodPerTick   = 0.00005 // Scales moodByHour
+	greetMood         = 0.15    // Mood gained from being greeted by the miko
+	moodLeaveBelow    = 0.15    // Visitors this unhappy cut their visit short
+	unhappyMoodBelow  = 0.3     // Visitors this unhappy show it above their head
+	generousMoodAbove = 0.75    // Visitors this happy offer the next larger coin or bill
+	stingyMoodBelow   = 0.25    // Visitors this unhappy offer the next smaller one
+
+	// Shrine cleanliness runs from 0 (littered) to 1 (spotless)
+	litterPerVisitor = 0.01 // Cleanliness lost with every visitor who arrives
+	tidyPerHour      = 0.1  // Cleanliness restored by the shrine's upkeep per in-game hour
+
+	// Reputation constants
+	reputationStart  = 3.0  // Stars of a shrine nobody has rated yet
+	reputationWeight = 0.05 // How much a new rating moves the reputation
+)
+
+// moodByHour is how pleasant a visit is at each hour of the day, from -1 to 1.
+// Crisp mornings are nice, the shrine is eerie in the dead of night.
+var moodByHour = [24]float64{
+	-1, -1, -1, -1, -0.5, 0,
+	0.5, 1, 1, 0.5, 0, 0,
+	0, 0, 0, 0, 0.5, 0.5,
+	0, -0.5, -0.5, -1, -1, -1,
+}
+
+// changeMood adds delta to the worshipper's mood, keeping it between 0 and 1
+func (w *Worshipper) changeMood(delta float64) {
+	w.Mood = math.Max(0, math.Min(1, w.Mood+delta))
+}
+
+// fedUp reports whether the worshipper is unhappy enough to go home early
+func (w *Worshipper) fedUp() bool {
+	return w.Mood < moodLeaveBelow
+}
+
+// offer settles the donation the worshipper makes at the box. Happy visitors
+// reach for a larger coin or bill than they planned, unhappy ones a smaller.
+func (w *Worshipper) offer() int {
+	switch {
+	case w.Mood >= generousMoodAbove:
+		w.Donation = nextDenomination(w.Donation, 1)
+	case w.Mood < stingyMoodBelow:
+		w.Donation = nextDenomination(w.Donation, -1)
+	}
+	return w.Donation
+}
+
+// Rating is the worshipper's verdict on the visit, from 1 to 5 stars
+func (w *Worshipper) Rating() int {
+	return 1 + int(math.Round(w.Mood*4))
+}
+
+// Reputation is the shrine's standing, built up from the ratings of the
+// visitors who have left
+type Reputation struct {
+	Stars   float64 // Recent ratings weigh more than old ones
+	Ratings int     // Ratings received
+}
+
+// NewReputation returns the reputation of a shrine nobody has rated yet
+func NewReputation() Reputation {
+	return Reputation{Stars: reputationStart}
+}
+
+// Add takes a visitor's rating into account
+func (r *Reputation) Add(rating int) {
+	r.Stars += (float64(rating) - r.Stars) * reputationWeight
+	r.Ratings++
+}
+
+// updateCleanliness lets the shrine's upkeep tidy the grounds over time
+func (g *MikoGameWithWorshippers) updateCleanliness() {
+	g.cleanliness = math.Min(1, g.cleanliness+tidyPerHour*g.clock.PerTick.Hours())
+}
+
+// litter dirties the grounds as a visitor arrives
+func (g *MikoGameWithWorshippers) litter() {
+	g.cleanliness = math.Max(0, g.cleanliness-litterPerVisitor)
+}
+
+// updateMoods changes every worshipper's mood by what they go through this
+// tick. It reuses the positions the steering layer put in the spatial grid.
+// A crowd changes slowly, so each worshipper only counts theirs every
+// crowdCountTicks ticks, spreading the counting over the ticks.
+func (g *MikoGameWithWorshippers) updateMoods() {
+	shared := hourMoodPerTick * moodByHour[g.clock.Time.Hour()]
+	if g.cleanliness > cleanMoodAbove {
+		shared += cleanMoodPerTick
+	} else {
+		shared -= dirtMoodPerTick * (1 - g.cleanliness/cleanMoodAbove)
+	}
+	shared -= g.chores.moodLoss()
+
+	for i, w := range g.worshippers.All() {
+		if w.State == StateLeaving {
+			continue
+		}
+		delta := shared
+
+		if i < len(g.steeringAgents) && (w.ID+g.tick)%crowdCountTicks == 0 {
+			agent := g.steeringAgents[i]
+			g.foundBuffer = g.steeringGrid.Query(agent.X, agent.Y, crowdRadius, g.foundBuffer[:0])
+			w.Crowd = 0
+			for _, f := range g.foundBuffer {
+				if f.Index != i && f.Index < g.worshippers.Len() {
+					w.Crowd++
+				}
+			}
+		}
+		if w.Crowd > crowdComfort {
+			delta -= crowdMoodPerTick * float64(w.Crowd-crowdComfort)
+		}
+
+		if w.State == StateQueueing {
+			delta -= queueMoodPerTick
+		}
+		w.changeMood(delta)
+	}
+}
+
+// averageMood returns the mean mood of the visitors on the map, or -1 if
+// there are none
+func (g *MikoGameWithWorshippers) averageMood() float64 {
+	if g.worshippers.Len() == 0 {
+		return -1
+	}
+	total := 0.0
+	for _, w := range g.worshippers.All() {
+		total += w.Mood
+	}
+	return total / float64(g.worshippers.Len())
+}
+
+// drawMoodMarker draws an anger mark above a worshipper in a bad mood
+func (g *MikoGameWithWorshippers) drawMoodMarker(screen *ebiten.Image, w *Worshipper) {
+	if w.Mood >= unhappyMoodBelow || w.State == StateConfused {
+		return
+	}
+	size := spriteSize(w.Image, w.Scale)
+	x := w.X - g.cameraX + size/2
+	y := w.Y - g.cameraY - 14
+	ebitenutil.DrawRect(screen, x-6, y-2, 14, 18, color.RGBA{220, 40, 40, 200})
+	ebitenutil.DebugPrintAt(screen, "#", int(x-2), int(y))
+}
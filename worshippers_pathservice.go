@@ -0,0 +1,305 @@
+package main
+
+import (
+	"log"
+	"math"
+	"runtime"
+)
+
+const (
+	pathRequestsPerTick = 4 // Maximum number of searches started per tick
+	pathResultBuffer    = 4 // Capacity of an agent's result channel
+)
+
+// PathRequest asks the path service for a route
+type PathRequest struct {
+	ID          int
+	AgentID     int
+	Start, Goal Point
+	GiveWay     bool // Yield to other agents on single-lane tiles
+	Result      chan<- PathResult
+}
+
+// PathResult is the answer to a PathRequest
+type PathResult struct {
+	RequestID int
+	Path      []Point
+	Err       error
+	StartTick int  // Tick at which the agent is expected on Path[0]
+	Scheduled bool // Path is reserved, waypoint i is due at StartTick + i*reservationStepFrames
+}
+
+// pathBatch is the work dispatched in one tick
+type pathBatch struct {
+	requests  []PathRequest
+	releases  []int      // Agents whose reservations are dropped before planning
+	shrineMap [][]TileID // Snapshot, the live map may be edited meanwhile
+	startTick int        // Tick at which the results are delivered
+	trace     bool       // Record searches for the debug overlay
+}
+
+// pathBatchResult holds the answers to a pathBatch in request order
+type pathBatchResult struct {
+	results []PathResult
+	bumped  []int           // Agents that have to give way and plan again
+	trace   PathSearchTrace // Last search of the batch, if traced
+}
+
+// PathService spreads pathfinding over ticks. Requests are answered in
+// submission order, at most pathRequestsPerTick per tick, and always exactly
+// one tick after they were dispatched. Whether the searches run inline or on
+// a worker goroutine therefore never changes what the simulation sees,
+// which keeps replays deterministic.
+//
+// Searches are cooperative: every path is reserved in a space-time table
+// that only the goroutine running the searches touches, and later searches
+// plan around it.
+type PathService struct {
+	queue    []PathRequest // In submission order, including superseded requests
+	latest   map[int]int   // ID of each agent's newest request still in the queue
+	releases []int
+	inFlight *pathBatch
+	computed pathBatchResult // Results of inFlight when running inline
+	nextID   int
+
+	reservations *ReservationTable
+
+	useWorker bool
+	work      chan *pathBatch
+	done      chan pathBatchResult
+}
+
+// NewPathService creates a path service. With useWorker the searches run on
+// a background goroutine while the rest of the frame is processed.
+func NewPathService(useWorker bool) *PathService {
+	s := &PathService{
+		useWorker:    useWorker,
+		latest:       make(map[int]int),
+		reservations: NewReservationTable(),
+	}
+	if useWorker {
+		s.work = make(chan *pathBatch)
+		s.done = make(chan pathBatchResult)
+		go s.worker()
+	}
+	return s
+}
+
+// defaultPathServiceWorker reports whether a worker goroutine is worth it.
+// WebAssembly runs all goroutines on a single thread.
+func defaultPathServiceWorker() bool {
+	return runtime.GOOS != "js"
+}
+
+func (s *PathService) worker() {
+	for batch := range s.work {
+		s.done <- s.computeBatch(batch)
+	}
+}
+
+// computeBatch plans every request of the batch in order
+func (s *PathService) computeBatch(batch *pathBatch) pathBatchResult {
+	var out pathBatchResult
+
+	startStep := batch.startTick / reservationStepFrames
+	s.reservations.Purge(startStep)
+	for _, agent := range batch.releases {
+		s.reservations.Release(agent)
+	}
+
+	for _, req := range batch.requests {
+		var trace *PathSearchTrace
+		if batch.trace {
+			trace = &out.trace
+			trace.reset(req.Start, req.Goal)
+		}
+		path, bumped, scheduled, err := findCooperativePath(batch.shrineMap, s.reservations,
+			req.AgentID, req.Start, req.Goal, startStep, req.GiveWay, trace)
+		if trace != nil {
+			trace.Path = path
+			trace.Err = err
+		}
+		out.bumped = append(out.bumped, bumped...)
+		out.results = append(out.results, PathResult{
+			RequestID: req.ID,
+			Path:      path,
+			Err:       err,
+			StartTick: startStep * reservationStepFrames,
+			Scheduled: scheduled,
+		})
+	}
+	return out
+}
+
+// Submit queues a request and returns its ID. Older requests of the same
+// agent are dropped, only the newest one matters. They stay in the queue
+// until Dispatch skips them, so submitting does not search the queue.
+func (s *PathService) Submit(req PathRequest) int {
+	s.nextID++
+	req.ID = s.nextID
+	s.queue = append(s.queue, req)
+	s.latest[req.AgentID] = req.ID
+	return req.ID
+}
+
+// Release drops the reservations and the queued request of an agent that no
+// longer follows a path
+func (s *PathService) Release(agentID int) {
+	s.releases = append(s.releases, agentID)
+	delete(s.latest, agentID)
+}
+
+// Pending returns the number of requests not dispatched yet
+func (s *PathService) Pending() int {
+	return len(s.latest)
+}
+
+// Deliver sends the results of the batch dispatched last tick to the agents
+// and returns the agents that were bumped and have to plan again.
+// Call it once per tick before the agents update.
+func (s *PathService) Deliver() []int {
+	if s.inFlight == nil {
+		return nil
+	}
+
+	out := s.computed
+	if s.useWorker {
+		out = <-s.done
+	}
+	for i, result := range out.results {
+		select {
+		case s.inFlight.requests[i].Result <- result:
+		default:
+			log.Printf("Warning: Dropped path result %d, agent is not reading its results", result.RequestID)
+		}
+	}
+	if s.inFlight.trace && debugPathTrace != nil && len(out.results) > 0 {
+		*debugPathTrace = out.trace
+	}
+
+	s.inFlight = nil
+	s.computed = pathBatchResult{}
+	return out.bumped
+}
+
+// Dispatch starts the searches for the next requests in line.
+// Call it once per tick after the agents submitted their requests.
+func (s *PathService) Dispatch(shrineMap [][]TileID, tick int) {
+	if len(s.latest) == 0 && len(s.releases) == 0 {
+		s.queue = s.queue[:0]
+		return
+	}
+
+	batch := &pathBatch{
+		releases:  s.releases,
+		shrineMap: copyShrineMap(shrineMap),
+		startTick: tick + 1,
+		trace:     debugPathTrace != nil,
+	}
+	taken := 0
+	for taken < len(s.queue) && len(batch.requests) < pathRequestsPerTick {
+		req := s.queue[taken]
+		taken++
+		if s.latest[req.AgentID] != req.ID {
+			// Superseded or released since it was submitted
+			continue
+		}
+		delete(s.latest, req.AgentID)
+		batch.requests = append(batch.requests, req)
+	}
+	s.queue = s.queue[taken:]
+	s.releases = nil
+	s.inFlight = batch
+
+	if s.useWorker {
+		s.work <- batch
+	} else {
+		s.computed = s.computeBatch(batch)
+	}
+}
+
+// copyShrineMap returns a deep copy of the map
+func copyShrineMap(shrineMap [][]TileID) [][]TileID {
+	snapshot := make([][]TileID, len(shrineMap))
+	for y := range shrineMap {
+		snapshot[y] = append([]TileID(nil), shrineMap[y]...)
+	}
+	return snapshot
+}
+
+// requestPath asks the path service for a route from the current tile to Goal.
+// With idle the worshipper stands still until the answer arrives, otherwise
+// it heads straight for the goal in the meantime.
+func (w *Worshipper) requestPath(env *WorshipperEnv, idle bool) {
+	w.PathInvalid = false
+	w.Path = w.Path[:0]
+	w.PathIndex = 0
+
+	start, err := findNearestWalkableTile(env.ShrineMap, w.X, w.Y)
+	if err != nil {
+		w.becomeConfused(err)
+		return
+	}
+	if w.pathResults == nil {
+		w.pathResults = make(chan PathResult, pathResultBuffer)
+	}
+	w.PendingPath = env.Paths.Submit(PathRequest{
+		AgentID: w.ID,
+		Start:   start,
+		Goal:    w.Goal,
+		GiveWay: w.isLeaving(),
+		Result:  w.pathResults,
+	})
+	w.IdleWhilePending = idle
+}
+
+// isLeaving reports whether the worshipper is on the way out, including
+// while confused on the way out
+func (w *Worshipper) isLeaving() bool {
+	return w.State == StateLeaving || (w.State == StateConfused && w.ResumeState == StateLeaving)
+}
+
+// awaitingPath applies a delivered path and reports whether the worshipper
+// is still waiting for one. While waiting it idles or walks straight towards
+// the goal.
+func (w *Worshipper) awaitingPath() bool {
+	for w.PendingPath != 0 {
+		select {
+		case result := <-w.pathResults:
+			if result.RequestID == w.PendingPath {
+				w.PendingPath = 0
+				w.applyPath(result)
+			}
+			continue
+		default:
+		}
+		break
+	}
+	if w.PendingPath == 0 {
+		return false
+	}
+
+	if !w.IdleWhilePending {
+		goalX, goalY := tileToPixel(w.Goal)
+		dx := goalX - w.X
+		dy := goalY - w.Y
+		w.setPreferredVelocity(dx, dy, math.Sqrt(dx*dx+dy*dy))
+	}
+	return true
+}
+
+// applyPath starts following a delivered path, or gets confused if there is none
+func (w *Worshipper) applyPath(result PathResult) {
+	if result.Err != nil {
+		w.becomeConfused(result.Err)
+		return
+	}
+	w.Path = append(w.Path[:0], result.Path...)
+	w.PathIndex = 0
+	w.NextTarget = result.Path[0]
+	w.PathStartTick = result.StartTick
+	w.PathScheduled = result.Scheduled
+	if w.State == StateConfused {
+		w.State = w.ResumeState
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"math"
+
+	"EdomaeElf/anim"
+)
+
+const (
+	// Where the miko's figure is within her sprite cell, as fractions of the
+	// cell. She collides with the tiles under this box, not the whole cell.
+	playerHitboxLeft   = 0.25
+	playerHitboxRight  = 0.75
+	playerHitboxTop    = 0.0625
+	playerHitboxBottom = 0.9375
+
+	// The hitbox is as wide as a tile. Edges this close to a tile boundary
+	// count as on it, so rounding errors do not catch on the next tile.
+	collisionTolerance = 1e-6
+)
+
+// Hitbox returns the box the miko collides with at her position, in map
+// pixels. The right and bottom edges are exclusive.
+func (p *Player) Hitbox() (x0, y0, x1, y1 float64) {
+	size := spriteSize(p.Image, playerSpriteScale)
+	return p.X + size*playerHitboxLeft, p.Y + size*playerHitboxTop,
+		p.X + size*playerHitboxRight, p.Y + size*playerHitboxBottom
+}
+
+// boxBlocked reports whether the box overlaps a tile that is not walkable.
+// Everything outside the map counts as blocked.
+func (g *MikoGameWithWorshippers) boxBlocked(x0, y0, x1, y1 float64) bool {
+	const tile = mikoTileSize * mikoScaleFactor
+	x0, y0 = x0+collisionTolerance, y0+collisionTolerance
+	x1, y1 = x1-collisionTolerance, y1-collisionTolerance
+	for y := int(math.Floor(y0 / tile)); y < int(math.Ceil(y1/tile)); y++ {
+		for x := int(math.Floor(x0 / tile)); x < int(math.Ceil(x1/tile)); x++ {
+			if !isWalkable(g.shrineMap, x, y) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// movePlayer moves the miko by (dx, dy), one axis at a time, so she slides
+// along a wall she walks into diagonally. A blocked move takes her up to the
+// wall. If a map edit put a wall on her, she walks freely until she is out.
+func (g *MikoGameWithWorshippers) movePlayer(dx, dy float64) {
+	const tile = mikoTileSize * mikoScaleFactor
+	p := g.player
+	stuck := g.boxBlocked(p.Hitbox())
+
+	if dx != 0 {
+		x0, y0, x1, y1 := p.Hitbox()
+		if !stuck && g.boxBlocked(x0+dx, y0, x1+dx, y1) {
+			if dx > 0 {
+				dx = math.Ceil(x1/tile)*tile - x1
+			} else {
+				dx = math.Floor(x0/tile)*tile - x0
+			}
+		}
+		p.X += dx
+	}
+	if dy != 0 {
+		x0, y0, x1, y1 := p.Hitbox()
+		if !stuck && g.boxBlocked(x0, y0+dy, x1, y1+dy) {
+			if dy > 0 {
+				dy = math.Ceil(y1/tile)*tile - y1
+			} else {
+				dy = math.Floor(y0/tile)*tile - y0
+			}
+		}
+		p.Y += dy
+	}
+
+	// Keep her on the map, which matters while she is walking out of a wall
+	x0, y0, x1, y1 := p.Hitbox()
+	p.X -= math.Min(x0, 0) + math.Max(x1-mikoMapWidth*tile, 0)
+	p.Y -= math.Min(y0, 0) + math.Max(y1-mikoMapHeight*tile, 0)
+}
+
+// Facing is the way the miko looks
+type Facing int
+
+const (
+	FacingDown Facing = iota // Towards the viewer, as she starts
+	FacingUp
+	FacingLeft
+	FacingRight
+)
+
+// face turns the miko the way she is trying to go, even into a wall, so she
+// faces the tile she walked up to. Standing still keeps the last way.
+func (p *Player) face(dx, dy float64) {
+	switch anim.WalkClip(dx, dy) {
+	case anim.WalkUp:
+		p.Facing = FacingUp
+	case anim.WalkDown:
+		p.Facing = FacingDown
+	case anim.WalkLeft:
+		p.Facing = FacingLeft
+	case anim.WalkRight:
+		p.Facing = FacingRight
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+// WorshipperPool holds the worshippers on the map. Removing a worshipper
+// moves the last one into the gap instead of shifting everyone behind it,
+// and keeps the removed one for the next visitor, who takes over its path
+// buffer and result channel instead of allocating new ones.
+type WorshipperPool struct {
+	active []*Worshipper
+	spare  []*Worshipper
+	byID   map[int]*Worshipper
+}
+
+// Len returns the number of worshippers on the map
+func (p *WorshipperPool) Len() int {
+	return len(p.active)
+}
+
+// All returns the worshippers on the map. The slice is only valid until the
+// next Add or Remove.
+func (p *WorshipperPool) All() []*Worshipper {
+	return p.active
+}
+
+// Add puts a worshipper on the map
+func (p *WorshipperPool) Add(w *Worshipper) {
+	if p.byID == nil {
+		p.byID = make(map[int]*Worshipper)
+	}
+	p.active = append(p.active, w)
+	p.byID[w.ID] = w
+}
+
+// ByID returns the worshipper with the given ID, nil if they are not on the map
+func (p *WorshipperPool) ByID(id int) *Worshipper {
+	return p.byID[id]
+}
+
+// Remove takes the worshipper at index i off the map. The last worshipper
+// takes their place, so callers walking the pool must look at index i again.
+func (p *WorshipperPool) Remove(i int) {
+	w := p.active[i]
+	last := len(p.active) - 1
+	p.active[i] = p.active[last]
+	p.active[last] = nil
+	p.active = p.active[:last]
+	delete(p.byID, w.ID)
+	p.spare = append(p.spare, w)
+}
+
+// recycled returns a worshipper who has left, or a new one if there is none.
+// Only the buffers NewWorshipper reuses are worth anything, it resets the rest.
+func (p *WorshipperPool) recycled() *Worshipper {
+	if p == nil || len(p.spare) == 0 {
+		return &Worshipper{}
+	}
+	last := len(p.spare) - 1
+	w := p.spare[last]
+	p.spare[last] = nil
+	p.spare = p.spare[:last]
+
+	// Results that were still on their way to the last visitor
+	for len(w.pathResults) > 0 {
+		<-w.pathResults
+	}
+	return w
+}
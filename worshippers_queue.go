@@ -0,0 +1,275 @@
+package main
+
+import (
+	"math"
+)
+
+const (
+	// Donation box queue constants
+	prayingSlotCount   = 3    // Worshippers that can pray at the same time
+	prayingSlotSpacing = 40.0 // Horizontal distance between praying slots in pixels
+	queueSpacing       = 32.0 // Distance between waiting worshippers along the sando
+	queueJoinRadius    = 48.0 // Approaching worshippers join the line within this distance of its tail
+	queueArrivalRadius = 3.0  // Distance at which a worshipper counts as standing on its spot
+	queueWaitSamples   = 20   // Number of recent waits used for the average wait time
+)
+
+// prayingTile is the walkable tile directly in front of the donation box
+var prayingTile = Point{donationBoxX, donationBoxY + 1}
+
+// queueStartTile and queueEndTile span the line along the sando behind the praying slots
+var (
+	queueStartTile = Point{donationBoxX, donationBoxY + 2}
+	queueEndTile   = Point{donationBoxX, mikoMapHeight - 1}
+)
+
+// DonationQueue hands out the praying slots in front of the donation box and
+// keeps everyone else waiting in line along the sando
+type DonationQueue struct {
+	slots   []*Worshipper // Worshipper praying in each slot, nil if free
+	waiting []*Worshipper // Waiting worshippers, head of the line first
+	line    [][2]float64  // Polyline the waiting line follows, in pixels
+
+	waitSamples []int // Recent wait times in frames, used as a ring buffer
+	nextSample  int
+}
+
+// NewDonationQueue creates an empty queue whose line follows the walkable sando
+func NewDonationQueue(shrineMap [][]TileID) *DonationQueue {
+	q := &DonationQueue{
+		slots: make([]*Worshipper, prayingSlotCount),
+	}
+	q.RebuildLine(shrineMap)
+	return q
+}
+
+// RebuildLine recomputes the polyline the waiting line follows
+func (q *DonationQueue) RebuildLine(shrineMap [][]TileID) {
+	path, err := findPath(shrineMap, queueStartTile, queueEndTile)
+	if err != nil {
+		// Fall back to a straight line down from the donation box
+		path = []Point{queueStartTile, queueEndTile}
+	}
+
+	q.line = q.line[:0]
+	for _, p := range path {
+		x, y := tileToPixel(p)
+		q.line = append(q.line, [2]float64{x, y})
+	}
+}
+
+// SlotPosition returns the pixel position of the given praying slot
+func (q *DonationQueue) SlotPosition(slot int) (float64, float64) {
+	x, y := tileToPixel(prayingTile)
+	offset := (float64(slot) - float64(prayingSlotCount-1)/2) * prayingSlotSpacing
+	return x + offset, y
+}
+
+// SpotPosition returns the pixel position of the given place in the waiting line
+func (q *DonationQueue) SpotPosition(index int) (float64, float64) {
+	remaining := float64(index) * queueSpacing
+	for i := 0; i+1 < len(q.line); i++ {
+		ax, ay := q.line[i][0], q.line[i][1]
+		bx, by := q.line[i+1][0], q.line[i+1][1]
+		segment := math.Hypot(bx-ax, by-ay)
+		if remaining <= segment {
+			t := remaining / segment
+			return ax + (bx-ax)*t, ay + (by-ay)*t
+		}
+		remaining -= segment
+	}
+
+	// Past the end of the line: keep going in the direction of the last segment
+	last := q.line[len(q.line)-1]
+	if len(q.line) < 2 {
+		return last[0], last[1] + remaining
+	}
+	prev := q.line[len(q.line)-2]
+	segment := math.Hypot(last[0]-prev[0], last[1]-prev[1])
+	return last[0] + (last[0]-prev[0])/segment*remaining,
+		last[1] + (last[1]-prev[1])/segment*remaining
+}
+
+// Len returns the number of worshippers waiting in line
+func (q *DonationQueue) Len() int {
+	return len(q.waiting)
+}
+
+// freeSlot returns the index of a free praying slot, or -1 if all are taken
+func (q *DonationQueue) freeSlot() int {
+	for i, w := range q.slots {
+		if w == nil {
+			return i
+		}
+	}
+	return -1
+}
+
+// IsBusy reports whether a newly arriving worshipper would have to wait
+func (q *DonationQueue) IsBusy() bool {
+	return len(q.waiting) > 0 || q.freeSlot() < 0
+}
+
+// ShouldJoin reports whether an approaching worshipper has reached the tail of the line
+func (q *DonationQueue) ShouldJoin(w *Worshipper) bool {
+	if !q.IsBusy() {
+		return false
+	}
+	tailX, tailY := q.SpotPosition(len(q.waiting))
+	return math.Hypot(tailX-w.X, tailY-w.Y) < queueJoinRadius
+}
+
+// roomFor reports whether there is a free praying slot for the worshipper.
+// Groups pray together, so the first of a group to step up waits until there
+// is a slot for everyone in the group who has yet to pray, or for as many as
+// there are slots.
+func (q *DonationQueue) roomFor(w *Worshipper) bool {
+	free := 0
+	for _, s := range q.slots {
+		if s == nil {
+			free++
+		}
+	}
+	if free == 0 || w.Group == nil || w.groupAtBox() {
+		return free > 0
+	}
+	return free >= w.Group.rowSize()
+}
+
+// Arrive gives the worshipper a praying slot if one is free and nobody is
+// waiting, otherwise puts them at the end of the line. Members of a group
+// line up right behind the others of their group.
+func (q *DonationQueue) Arrive(w *Worshipper) {
+	w.Timer = 0
+	w.QueueTimer = 0
+	w.Praying = false
+
+	if len(q.waiting) == 0 && q.roomFor(w) {
+		q.assign(w, q.freeSlot())
+		return
+	}
+
+	w.State = StateQueueing
+	at := len(q.waiting)
+	if w.Group != nil {
+		for i, waiting := range q.waiting {
+			if waiting.Group == w.Group {
+				at = i + 1
+			}
+		}
+	}
+	q.waiting = append(q.waiting, nil)
+	copy(q.waiting[at+1:], q.waiting[at:])
+	q.waiting[at] = w
+	q.reindex()
+}
+
+// assign moves the worshipper into a praying slot and records how long they waited
+func (q *DonationQueue) assign(w *Worshipper, slot int) {
+	q.slots[slot] = w
+	w.State = StateVisiting
+	w.Slot = slot
+	w.QueueIndex = -1
+	q.recordWait(w.QueueTimer)
+}
+
+// LeaveLine takes a worshipper who gives up waiting out of the line
+func (q *DonationQueue) LeaveLine(w *Worshipper) {
+	for i, waiting := range q.waiting {
+		if waiting == w {
+			q.waiting = append(q.waiting[:i], q.waiting[i+1:]...)
+			break
+		}
+	}
+	w.QueueIndex = -1
+	q.callForward()
+}
+
+// CutIn moves a waiting worshipper to the head of the line and returns the
+// worshippers who were passed
+func (q *DonationQueue) CutIn(w *Worshipper) []*Worshipper {
+	if w.QueueIndex <= 0 || w.QueueIndex >= len(q.waiting) {
+		return nil
+	}
+	passed := append([]*Worshipper(nil), q.waiting[:w.QueueIndex]...)
+	copy(q.waiting[1:w.QueueIndex+1], q.waiting[:w.QueueIndex])
+	q.waiting[0] = w
+	q.reindex()
+	return passed
+}
+
+// SendToBack moves a waiting worshipper to the end of the line
+func (q *DonationQueue) SendToBack(w *Worshipper) {
+	if w.QueueIndex < 0 || w.QueueIndex >= len(q.waiting) {
+		return
+	}
+	q.waiting = append(q.waiting[:w.QueueIndex], q.waiting[w.QueueIndex+1:]...)
+	q.waiting = append(q.waiting, w)
+	q.reindex()
+}
+
+// reindex tells every waiting worshipper their place in line
+func (q *DonationQueue) reindex() {
+	for i, waiting := range q.waiting {
+		waiting.QueueIndex = i
+	}
+}
+
+// Leave frees the worshipper's praying slot and calls the head of the line forward
+func (q *DonationQueue) Leave(w *Worshipper) {
+	if w.Slot >= 0 && w.Slot < len(q.slots) && q.slots[w.Slot] == w {
+		q.slots[w.Slot] = nil
+	}
+	w.Slot = -1
+	q.callForward()
+}
+
+// callForward moves the head of the line into the free praying slots
+func (q *DonationQueue) callForward() {
+	for len(q.waiting) > 0 && q.roomFor(q.waiting[0]) {
+		next := q.waiting[0]
+		q.waiting = q.waiting[1:]
+		q.assign(next, q.freeSlot())
+	}
+	q.reindex()
+}
+
+func (q *DonationQueue) recordWait(frames int) {
+	if len(q.waitSamples) < queueWaitSamples {
+		q.waitSamples = append(q.waitSamples, frames)
+		return
+	}
+	q.waitSamples[q.nextSample] = frames
+	q.nextSample = (q.nextSample + 1) % queueWaitSamples
+}
+
+// AverageWait returns the average wait of recent worshippers in frames
+func (q *DonationQueue) AverageWait() float64 {
+	if len(q.waitSamples) == 0 {
+		return 0
+	}
+	total := 0
+	for _, frames := range q.waitSamples {
+		total += frames
+	}
+	return float64(total) / float64(len(q.waitSamples))
+}
+
+// moveToSpot sets the preferred velocity towards a spot and reports whether
+// the worshipper is already standing on it
+func (w *Worshipper) moveToSpot(x, y float64) bool {
+	dx := x - w.X
+	dy := y - w.Y
+	distance := math.Sqrt(dx*dx + dy*dy)
+	if distance < queueArrivalRadius {
+		return true
+	}
+
+	w.setPreferredVelocity(dx, dy, distance)
+	// Slow down on the last pixels so worshippers don't overshoot their spot
+	if distance < w.Speed {
+		w.PrefVX = dx
+		w.PrefVY = dy
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"EdomaeElf/input"
+)
+
+// rebindLabelWidth is the width of the column of action names on the rebinding screen
+const rebindLabelWidth = 200
+
+// RebindScreen lists the actions and lets the player change their bindings.
+// Its own controls are fixed, so it works however the actions are bound:
+// arrows, Enter, Backspace, Delete and Escape, or the d-pad and A, X, Y and B.
+type RebindScreen struct {
+	Open      bool
+	Cursor    int  // Action selected
+	Capturing bool // Waiting for the key, button or stick direction to bind
+	centered  bool // The sticks have been let go since capturing started
+}
+
+// rebindPressed reports whether the key or a gamepad button was pressed
+// this frame
+func (g *MikoGameWithWorshippers) rebindPressed(key ebiten.Key, button ebiten.StandardGamepadButton) bool {
+	if inpututil.IsKeyJustPressed(key) {
+		return true
+	}
+	for _, id := range g.input.Pads() {
+		if inpututil.IsStandardGamepadButtonJustPressed(id, button) {
+			return true
+		}
+	}
+	return false
+}
+
+// capturedBinding returns the key, gamepad button or stick direction
+// pressed this frame. A stick only counts once both sticks were centered,
+// so the stick that picked the action is not bound right away.
+func (g *MikoGameWithWorshippers) capturedBinding() (input.Binding, bool) {
+	screen := &g.rebind
+	if keys := inpututil.AppendJustPressedKeys(nil); len(keys) > 0 {
+		return input.Key(keys[0]), true
+	}
+	for _, id := range g.input.Pads() {
+		if buttons := inpututil.AppendJustPressedStandardGamepadButtons(id, nil); len(buttons) > 0 {
+			if _, ok := input.PadButtonNames[buttons[0]]; ok {
+				return input.Pad(buttons[0]), true
+			}
+		}
+	}
+
+	tilted := false
+	for stick := range input.StickNames {
+		b := input.StickDirection(stick.Axis, stick.Sign)
+		if g.input.BindingValue(b) > 0 {
+			tilted = true
+		}
+		if screen.centered && g.input.BindingValue(b) >= input.PressedValue {
+			return b, true
+		}
+	}
+	if !tilted {
+		screen.centered = true
+	}
+	return input.Binding{}, false
+}
+
+// updateRebindScreen opens and closes the rebinding screen and handles its
+// controls. While it is open the actions read as released.
+func (g *MikoGameWithWorshippers) updateRebindScreen() {
+	screen := &g.rebind
+	actions := &g.input
+	if !screen.Open {
+		if actions.JustPressed(InputBindings) {
+			screen.Open, screen.Cursor, screen.Capturing = true, 0, false
+			g.route = nil
+		}
+		actions.Disabled = screen.Open
+		return
+	}
+
+	if screen.Capturing {
+		if inpututil.IsKeyJustPressed(ebiten.KeyEscape) {
+			screen.Capturing = false
+			return
+		}
+		b, ok := g.capturedBinding()
+		if !ok {
+			return
+		}
+		screen.Capturing = false
+		action := InputAction(screen.Cursor)
+		if previous, taken := actions.Bind(action, b); taken {
+			g.notify(fmt.Sprintf("%sを「%s」から外して「%s」に割り当てた", b.Label(), inputActions[previous].Label, inputActions[action].Label))
+		} else {
+			g.notify(fmt.Sprintf("%sを「%s」に割り当てた", b.Label(), inputActions[action].Label))
+		}
+		g.storeBindings()
+		return
+	}
+
+	// The screen itself still reads the move and rebinding actions
+	actions.Disabled = false
+	up := actions.JustPressed(InputMoveUp) || inpututil.IsKeyJustPressed(ebiten.KeyArrowUp)
+	down := actions.JustPressed(InputMoveDown) || inpututil.IsKeyJustPressed(ebiten.KeyArrowDown)
+	closing := actions.JustPressed(InputBindings)
+	actions.Disabled = true
+
+	switch {
+	case closing || g.rebindPressed(ebiten.KeyEscape, ebiten.StandardGamepadButtonRightRight):
+		screen.Open = false
+		actions.Disabled = false
+	case up:
+		screen.Cursor = (screen.Cursor + inputActionCount - 1) % inputActionCount
+	case down:
+		screen.Cursor = (screen.Cursor + 1) % inputActionCount
+	case g.rebindPressed(ebiten.KeyEnter, ebiten.StandardGamepadButtonRightBottom):
+		screen.Capturing, screen.centered = true, false
+	case g.rebindPressed(ebiten.KeyBackspace, ebiten.StandardGamepadButtonRightLeft):
+		actions.Bindings[screen.Cursor] = nil
+		g.notify(fmt.Sprintf("「%s」の割り当てを外した", inputActions[screen.Cursor].Label))
+		g.storeBindings()
+	case g.rebindPressed(ebiten.KeyDelete, ebiten.StandardGamepadButtonRightTop):
+		actions.Reset()
+		g.notify("操作設定を初期設定に戻した")
+		g.storeBindings()
+	}
+}
+
+// storeBindings saves the bindings after a change on the rebinding screen
+func (g *MikoGameWithWorshippers) storeBindings() {
+	if err := saveBindings(&g.input); err != nil {
+		log.Printf("Warning: Could not save the bindings: %v", err)
+		g.notify("操作設定を保存できなかった")
+	}
+}
+
+// drawRebindScreen lists the actions with their bindings
+func (g *MikoGameWithWorshippers) drawRebindScreen(screen *ebiten.Image) {
+	rebind := &g.rebind
+	if !rebind.Open {
+		return
+	}
+
+	const x, y, width, lineHeight = 40.0, 40.0, mikoScreenWidth - 80.0, 16
+	height := float64((inputActionCount + 5) * lineHeight)
+	ebitenutil.DrawRect(screen, x, y, width, height, color.RGBA{10, 20, 40, 230})
+	ebitenutil.DrawRect(screen, x+4, y+8+float64((rebind.Cursor+1)*lineHeight), width-8, lineHeight, color.RGBA{90, 70, 20, 230})
+
+	drawText(screen, "操作設定", x+8, y+8)
+	for action, info := range inputActions {
+		labels := make([]string, 0, len(g.input.Bindings[action]))
+		for _, b := range g.input.Bindings[action] {
+			labels = append(labels, b.Label())
+		}
+		bound := strings.Join(labels, ", ")
+		if rebind.Capturing && action == rebind.Cursor {
+			bound += " ... 割り当てるキー・ボタン・スティックを押す (Esc: やめる)"
+		}
+		row := y + 8 + float64((action+1)*lineHeight)
+		drawText(screen, info.Label, x+8, row)
+		drawText(screen, bound, x+8+rebindLabelWidth, row)
+	}
+	drawText(screen, "↑↓: 選ぶ  Enter/パッドA: 割り当てを追加  Backspace/パッドX: 割り当てを外す\n"+
+		"Delete/パッドY: 初期設定に戻す  Esc/パッドB: 閉じる", x+8, y+8+float64((inputActionCount+2)*lineHeight))
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// Returning visitor constants
+	regularsMax         = 50 // Visitors the book has room for
+	regularJoinRating   = 4  // Visitors who rate their visit this well may come back as regulars
+	regularSoonerRating = 5  // Regulars who rate a visit this well come back a day sooner
+	regularLaterRating  = 2  // Regulars who rate a visit this poorly come back half as often
+	regularLapseRating  = 1  // Regulars who rate a visit this badly stop coming
+	regularMaxEveryDays = 28 // Longest gap between the visits of a regular
+	visitorBookRows     = 20 // Regulars shown on a page of the visitor book
+)
+
+// visitorBookColumns are where the columns of the visitor book start, in
+// pixels from its left edge
+var visitorBookColumns = []float64{0, 110, 220, 280, 340, 440, 540}
+
+// regularEveryDays is the range the days between a new regular's visits are drawn from
+var regularEveryDays = IntRange{Min: 1, Max: 7}
+
+// regularSurnames are the names regulars are known by at the shrine
+var regularSurnames = []string{
+	"佐藤", "鈴木", "高橋", "田中", "伊藤", "渡辺", "山本", "中村", "小林", "加藤",
+	"吉田", "山田", "佐々木", "山口", "松本", "井上", "木村", "林", "斎藤", "清水",
+}
+
+// RegularVisitor is a visitor who comes back to the shrine. They keep the
+// visitor ID of their first visit, so the ledger knows them on every return.
+type RegularVisitor struct {
+	ID         int       `json:"id"`
+	Name       string    `json:"name"`
+	Archetype  string    `json:"archetype"` // ID of the visitor's archetype
+	Tint       [3]uint8  `json:"tint"`      // Color they are recognized by
+	Visits     int       `json:"visits"`
+	Hours      [24]int   `json:"hours"`    // Visits by the hour they ended in
+	TotalYen   int       `json:"totalYen"` // Yen offered over all visits
+	Stars      int       `json:"stars"`    // Rating of the last visit
+	FirstVisit time.Time `json:"firstVisit"`
+	LastVisit  time.Time `json:"lastVisit"`
+	EveryDays  int       `json:"everyDays"` // Days between visits
+	NextVisit  time.Time `json:"nextVisit"` // In-game time of the next visit
+	Lapsed     bool      `json:"lapsed"`    // Stopped coming after a bad visit
+
+	visiting bool // On the map right now
+}
+
+// FavoriteHour returns the hour of the day the regular visits most often,
+// the earliest one on a tie
+func (r *RegularVisitor) FavoriteHour() int {
+	favorite := 0
+	for hour, visits := range r.Hours {
+		if visits > r.Hours[favorite] {
+			favorite = hour
+		}
+	}
+	return favorite
+}
+
+// timeOfDayName names the part of the day an hour belongs to
+func timeOfDayName(hour int) string {
+	switch {
+	case hour >= 4 && hour < 7:
+		return "早朝"
+	case hour >= 7 && hour < 11:
+		return "朝"
+	case hour >= 11 && hour < 14:
+		return "昼"
+	case hour >= 14 && hour < 18:
+		return "午後"
+	case hour >= 18 && hour < 21:
+		return "夕方"
+	}
+	return "夜"
+}
+
+// recordVisit adds a finished visit and plans the next one. A good visit
+// brings the regular back sooner, a poor one later, and a bad one not at all.
+func (r *RegularVisitor) recordVisit(w *Worshipper, now time.Time, rng *rand.Rand) {
+	r.Visits++
+	r.Hours[now.Hour()]++
+	if w.Prayed {
+		r.TotalYen += w.Donation
+	}
+	r.Stars = w.Rating()
+	r.LastVisit = now
+
+	switch {
+	case r.Stars <= regularLapseRating:
+		r.Lapsed = true
+	case r.Stars <= regularLaterRating:
+		r.EveryDays = min(r.EveryDays*2, regularMaxEveryDays)
+	case r.Stars >= regularSoonerRating:
+		r.EveryDays = max(r.EveryDays-1, 1)
+	}
+	day := startOfDay(now).AddDate(0, 0, r.EveryDays)
+	r.NextVisit = day.Add(time.Duration(r.FavoriteHour())*time.Hour + time.Duration(rng.Intn(60))*time.Minute)
+}
+
+// VisitorRegistry is the visitor book: the regulars of the shrine, in the
+// order they first came. The zero value is an empty book.
+type VisitorRegistry struct {
+	Regulars []*RegularVisitor
+}
+
+// NewVisitorRegistry returns a book holding copies of the given regulars, e.g. from a save
+func NewVisitorRegistry(regulars []RegularVisitor) VisitorRegistry {
+	r := VisitorRegistry{}
+	for _, regular := range regulars {
+		regular.visiting = false
+		r.Regulars = append(r.Regulars, &regular)
+	}
+	return r
+}
+
+// Snapshot returns copies of the regulars for the save
+func (r *VisitorRegistry) Snapshot() []RegularVisitor {
+	regulars := make([]RegularVisitor, len(r.Regulars))
+	for i, regular := range r.Regulars {
+		regulars[i] = *regular
+	}
+	return regulars
+}
+
+// Due returns a regular whose next visit has come and who is not on the
+// map yet, nil if nobody is due
+func (r *VisitorRegistry) Due(now time.Time) *RegularVisitor {
+	for _, regular := range r.Regulars {
+		if !regular.Lapsed && !regular.visiting && !now.Before(regular.NextVisit) {
+			return regular
+		}
+	}
+	return nil
+}
+
+// Visiting returns the number of regulars on the map
+func (r *VisitorRegistry) Visiting() int {
+	n := 0
+	for _, regular := range r.Regulars {
+		if regular.visiting {
+			n++
+		}
+	}
+	return n
+}
+
+// pickName chooses a surname nobody in the book goes by yet, numbering the
+// surname once they are all taken
+func (r *VisitorRegistry) pickName(rng *rand.Rand) string {
+	taken := make(map[string]bool, len(r.Regulars))
+	for _, regular := range r.Regulars {
+		taken[regular.Name] = true
+	}
+	start := rng.Intn(len(regularSurnames))
+	for n := 1; ; n++ {
+		for i := range regularSurnames {
+			name := regularSurnames[(start+i)%len(regularSurnames)] + "さん"
+			if n > 1 {
+				name = fmt.Sprintf("%s%d", name, n)
+			}
+			if !taken[name] {
+				return name
+			}
+		}
+	}
+}
+
+// enroll writes a visitor who enjoyed their visit into the book
+func (r *VisitorRegistry) enroll(w *Worshipper, now time.Time, rng *rand.Rand) *RegularVisitor {
+	regular := &RegularVisitor{
+		ID:         w.ID,
+		Name:       r.pickName(rng),
+		Archetype:  w.Archetype.ID,
+		Tint:       [3]uint8{w.Color.R, w.Color.G, w.Color.B},
+		FirstVisit: now,
+		EveryDays:  regularEveryDays.Draw(rng),
+	}
+	regular.recordVisit(w, now, rng)
+	r.Regulars = append(r.Regulars, regular)
+	return regular
+}
+
+// spawnRegular brings a regular whose visit is due onto the map, alone and
+// in their own color. Regulars keep to their own schedule rather than the
+// spawn curve, but wait while the grounds are full.
+func (g *MikoGameWithWorshippers) spawnRegular(env *WorshipperEnv) {
+	if g.schedule.MaxVisitors > 0 && g.worshippers.Len() >= g.schedule.MaxVisitors {
+		return
+	}
+	regular := g.regulars.Due(g.clock.Time)
+	if regular == nil {
+		return
+	}
+	archetype := g.archetypeByID(regular.Archetype)
+	if archetype == nil {
+		// The kind of visitor is gone from the data file
+		regular.Lapsed = true
+		return
+	}
+
+	w := NewWorshipper(regular.ID, archetype, env)
+	w.Color = color.RGBA{regular.Tint[0], regular.Tint[1], regular.Tint[2], 255}
+	w.Regular = regular
+	regular.visiting = true
+	g.worshippers.Add(w)
+	g.litter()
+}
+
+// archetypeByID returns the archetype with the given ID, nil if there is none
+func (g *MikoGameWithWorshippers) archetypeByID(id string) *Archetype {
+	for _, a := range g.archetypes {
+		if a.ID == id {
+			return a
+		}
+	}
+	return nil
+}
+
+// recordVisitor updates the book as a worshipper leaves: a regular's visit
+// is added, and a visitor who came alone and enjoyed it may become one
+func (g *MikoGameWithWorshippers) recordVisitor(w *Worshipper) {
+	if regular := w.Regular; regular != nil {
+		regular.visiting = false
+		regular.recordVisit(w, g.clock.Time, g.rng)
+		return
+	}
+	if w.Archetype == nil || w.Group != nil || w.Rating() < regularJoinRating || len(g.regulars.Regulars) >= regularsMax {
+		return
+	}
+	if g.rng.Float64() < w.Archetype.Return {
+		regular := g.regulars.enroll(w, g.clock.Time, g.rng)
+		g.notify(fmt.Sprintf("%sが参拝者名簿に加わった", regular.Name))
+	}
+}
+
+// displayName returns what the HUD calls the worshipper: their name if
+// they are a regular, otherwise their kind of visitor
+func (w *Worshipper) displayName() string {
+	switch {
+	case w.Regular != nil:
+		return w.Regular.Name
+	case w.Archetype != nil:
+		return w.Archetype.Name
+	}
+	return "参拝客"
+}
+
+// regularsHUD returns the HUD line about the regulars, empty if there are none
+func (g *MikoGameWithWorshippers) regularsHUD() string {
+	if len(g.regulars.Regulars) == 0 {
+		return ""
+	}
+	return fmt.Sprintf("常連: %d人 (来訪中: %d人)\n", len(g.regulars.Regulars), g.regulars.Visiting())
+}
+
+// VisitorBook is the screen listing the regulars
+type VisitorBook struct {
+	Open bool
+	Page int
+}
+
+// updateVisitorBook opens and closes the visitor book and turns its pages
+func (g *MikoGameWithWorshippers) updateVisitorBook() {
+	book := &g.visitorBook
+	if g.input.JustPressed(InputVisitorBook) {
+		book.Open = !book.Open
+		book.Page = 0
+	}
+	if !book.Open {
+		return
+	}
+	pages := max(1, (len(g.regulars.Regulars)+visitorBookRows-1)/visitorBookRows)
+	if g.input.JustPressed(InputPageDown) {
+		book.Page = min(book.Page+1, pages-1)
+	}
+	if g.input.JustPressed(InputPageUp) {
+		book.Page = max(book.Page-1, 0)
+	}
+}
+
+// drawVisitorBook lists the regulars, the most frequent visitors first
+func (g *MikoGameWithWorshippers) drawVisitorBook(screen *ebiten.Image) {
+	book := &g.visitorBook
+	if !book.Open {
+		return
+	}
+	regulars := slices.Clone(g.regulars.Regulars)
+	slices.SortStableFunc(regulars, func(a, b *RegularVisitor) int {
+		return b.Visits - a.Visits
+	})
+	pages := max(1, (len(regulars)+visitorBookRows-1)/visitorBookRows)
+
+	const x, y, width = 40.0, 60.0, mikoScreenWidth - 80.0
+	height := float64((visitorBookRows + 4) * textLineHeight)
+	ebitenutil.DrawRect(screen, x, y, width, height, color.RGBA{40, 20, 10, 230})
+	line := func(i int) float64 { return y + 8 + float64(i*textLineHeight) }
+
+	drawText(screen, fmt.Sprintf("参拝者名簿  常連 %d人  (%d/%dページ)", len(regulars), book.Page+1, pages), x+8, line(0))
+	rows := [][]string{{"名前", "種類", "来訪", "時間帯", "奉納累計", "前回", "次回"}}
+	start := book.Page * visitorBookRows
+	for _, r := range regulars[min(start, len(regulars)):min(start+visitorBookRows, len(regulars))] {
+		kind := r.Archetype
+		if a := g.archetypeByID(r.Archetype); a != nil {
+			kind = a.Name
+		}
+		next := r.NextVisit.Format("1/2 15:04")
+		switch {
+		case r.visiting:
+			next = "来訪中"
+		case r.Lapsed:
+			next = "足が遠のいた"
+		}
+		rows = append(rows, []string{r.Name, kind, fmt.Sprintf("%d回", r.Visits), timeOfDayName(r.FavoriteHour()),
+			fmt.Sprintf("%d円", r.TotalYen), r.LastVisit.Format("1/2 15:04"), next})
+	}
+	// Japanese characters are twice as wide as digits, so the columns are
+	// placed by pixel rather than padded with spaces
+	for i, row := range rows {
+		for j, cell := range row {
+			drawText(screen, cell, x+8+visitorBookColumns[j], line(i+1))
+		}
+	}
+	if len(regulars) == 0 {
+		drawText(screen, "まだ常連はいない。満足した参拝客がまた来てくれるかも", x+8, line(2))
+	}
+	drawText(screen, fmt.Sprintf("%s: 閉じる  %s/%s: ページ送り", g.input.Label(InputVisitorBook), g.input.Label(InputPageUp), g.input.Label(InputPageDown)),
+		x+8, line(visitorBookRows+3))
+}
+
+// drawRegularTag writes a regular's name under their feet, so they can be
+// told apart in the crowd
+func (g *MikoGameWithWorshippers) drawRegularTag(screen *ebiten.Image, w *Worshipper) {
+	if w.Regular == nil {
+		return
+	}
+	cx, cy := worshipperCenter(w)
+	size := spriteSize(w.Image, w.Scale)
+	x, y := cx-g.cameraX, cy-g.cameraY+size/2+4
+	width := textWidth(w.Regular.Name) + 4
+	ebitenutil.DrawRect(screen, x-width/2, y, width, textLineHeight, color.RGBA{40, 20, 10, 160})
+	drawText(screen, w.Regular.Name, x-width/2+2, y)
+}
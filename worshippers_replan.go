@@ -0,0 +1,167 @@
+package main
+
+import (
+	"image/color"
+	"log"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	confusedRetryInterval = 60  // Frames between replanning attempts while confused
+	confusedGiveUpFrames  = 600 // Frames a confused worshipper keeps trying before heading home
+)
+
+// MapChange describes a single tile edit
+type MapChange struct {
+	Tile        Point
+	Old, New    TileID
+	WasWalkable bool
+	IsWalkable  bool
+}
+
+// WalkabilityChanged reports whether the edit opened or closed the tile
+func (c MapChange) WalkabilityChanged() bool {
+	return c.WasWalkable != c.IsWalkable
+}
+
+// MapChangeListener is notified after a tile of the shrine map was replaced
+type MapChangeListener func(change MapChange)
+
+// addMapChangeListener registers a listener for tile edits
+func (g *MikoGameWithWorshippers) addMapChangeListener(listener MapChangeListener) {
+	g.mapChangeListeners = append(g.mapChangeListeners, listener)
+}
+
+// setTile replaces a tile of the shrine map and notifies the listeners
+func (g *MikoGameWithWorshippers) setTile(p Point, tile TileID) {
+	if !isValidPosition(p) {
+		return
+	}
+	old := g.shrineMap[p.Y][p.X]
+	if old == tile {
+		return
+	}
+
+	change := MapChange{
+		Tile:        p,
+		Old:         old,
+		New:         tile,
+		WasWalkable: isWalkable(g.shrineMap, p.X, p.Y),
+	}
+	g.shrineMap[p.Y][p.X] = tile
+	change.IsWalkable = isWalkable(g.shrineMap, p.X, p.Y)
+
+	for _, listener := range g.mapChangeListeners {
+		listener(change)
+	}
+}
+
+// invalidateWorshipperPaths marks the paths that an edit affects so the
+// worshippers replan on their next update
+func (g *MikoGameWithWorshippers) invalidateWorshipperPaths(change MapChange) {
+	if !change.WalkabilityChanged() {
+		return
+	}
+	for _, w := range g.worshippers.All() {
+		if w.pathAffectedBy(change) {
+			w.PathInvalid = true
+		}
+	}
+}
+
+// rebuildQueueLine keeps the waiting line on the walkable sando
+func (g *MikoGameWithWorshippers) rebuildQueueLine(change MapChange) {
+	if change.WalkabilityChanged() {
+		g.donationQueue.RebuildLine(g.shrineMap)
+	}
+}
+
+// pathAffectedBy reports whether the remaining path has to be recomputed
+func (w *Worshipper) pathAffectedBy(change MapChange) bool {
+	switch w.State {
+	case StateWalking, StateLeaving:
+	case StateConfused:
+		// An opened tile may be the way out, so try again right away
+		if change.IsWalkable {
+			w.ConfusedTimer = confusedRetryInterval - 1
+		}
+		return false
+	default:
+		return false
+	}
+
+	// A pending answer was computed on the old map
+	if w.PendingPath != 0 {
+		return true
+	}
+
+	if w.PathIndex >= len(w.Path) {
+		// Leaving worshippers past the end of their path just walk off-screen
+		return w.State == StateWalking
+	}
+
+	// A new shortcut may appear anywhere, so every walking worshipper replans
+	if change.IsWalkable {
+		return true
+	}
+
+	for _, p := range w.Path[w.PathIndex:] {
+		if p == change.Tile {
+			return true
+		}
+	}
+	return false
+}
+
+// becomeConfused stops the worshipper instead of letting it walk through walls
+func (w *Worshipper) becomeConfused(err error) {
+	if w.State != StateConfused {
+		log.Printf("Warning: Worshipper is confused: %v", err)
+		w.ResumeState = w.State
+		w.State = StateConfused
+		w.ConfusedTimer = 0
+	}
+	w.Path = w.Path[:0]
+	w.PathIndex = 0
+}
+
+// updateConfused retries planning from time to time and reports whether the
+// worshipper gives up on the current stop. Nobody gives up on going home.
+func (w *Worshipper) updateConfused(env *WorshipperEnv) bool {
+	if w.awaitingPath() {
+		return false
+	}
+
+	w.ConfusedTimer++
+	if w.ConfusedTimer%confusedRetryInterval != 0 {
+		return false
+	}
+
+	if w.ResumeState == StateWalking && w.ConfusedTimer >= confusedGiveUpFrames {
+		return true
+	}
+	w.requestPath(env, true)
+	return false
+}
+
+// exitTile returns the walkable tile the worshipper leaves the map from
+func (w *Worshipper) exitTile(shrineMap [][]TileID) Point {
+	exitTile, err := findNearestWalkableTile(shrineMap, w.TargetX, float64(mikoMapHeight-1)*mikoTileSize*mikoScaleFactor)
+	if err != nil {
+		// Log error but continue with fallback behavior
+		log.Printf("Warning: Could not find walkable exit tile: %v", err)
+		exitTile = Point{mikoMapWidth / 2, mikoMapHeight - 1}
+	}
+	return exitTile
+}
+
+// drawConfusedMarker draws a question mark above a confused worshipper
+func (g *MikoGameWithWorshippers) drawConfusedMarker(screen *ebiten.Image, w *Worshipper) {
+	size := spriteSize(w.Image, w.Scale)
+	x := w.X - g.cameraX + size/2
+	y := w.Y - g.cameraY - 14
+	ebitenutil.DrawRect(screen, x-6, y-2, 14, 18, color.RGBA{255, 255, 255, 200})
+	ebitenutil.DebugPrintAt(screen, "?", int(x-2), int(y))
+}
@@ -0,0 +1,251 @@
+package main
+
+import (
+	"container/heap"
+)
+
+const (
+	// Cooperative pathfinding constants
+	reservationStepFrames   = 64 // Frames per space-time step, one tile at base speed
+	reservationExtraHorizon = 24 // Steps allowed beyond the length of the plain path
+)
+
+// singleLaneTiles are the narrow tiles of the sando and the stairs, where
+// visitors walk in single file and leaving visitors give way
+var singleLaneTiles = map[TileID]bool{
+	{0, 1}: true, // Stone path (vertical)
+	{0, 3}: true, // Stone stairs (top)
+	{0, 6}: true, // Stone stairs (middle)
+	{1, 6}: true, // Stone stairs (bottom)
+}
+
+// isSingleLane checks if the tile at the given coordinates is a single-lane tile
+func isSingleLane(shrineMap [][]TileID, p Point) bool {
+	return isValidPosition(p) && singleLaneTiles[shrineMap[p.Y][p.X]]
+}
+
+// reservationKey is a tile at a space-time step
+type reservationKey struct {
+	Tile Point
+	Step int
+}
+
+// ReservationTable remembers where every agent plans to be at every step,
+// so later searches can plan around earlier ones (cooperative A*)
+type ReservationTable struct {
+	owners  map[reservationKey]int
+	byAgent map[int][]reservationKey
+	giveWay map[int]bool // Agents that yield on single-lane tiles
+	purged  int          // Steps before this one are already forgotten
+}
+
+// NewReservationTable creates an empty reservation table
+func NewReservationTable() *ReservationTable {
+	return &ReservationTable{
+		owners:  make(map[reservationKey]int),
+		byAgent: make(map[int][]reservationKey),
+		giveWay: make(map[int]bool),
+	}
+}
+
+// owner returns the agent holding the tile at the step, 0 if it is free
+func (t *ReservationTable) owner(p Point, step int) int {
+	return t.owners[reservationKey{p, step}]
+}
+
+// Reserve claims the tiles of a path, one step per waypoint from startStep.
+// Tiles already held by other agents are left to them.
+func (t *ReservationTable) Reserve(agent int, path []Point, startStep int, giveWay bool) {
+	for i, p := range path {
+		key := reservationKey{p, startStep + i}
+		if owner := t.owners[key]; owner != 0 && owner != agent {
+			continue
+		}
+		t.owners[key] = agent
+		t.byAgent[agent] = append(t.byAgent[agent], key)
+	}
+	t.giveWay[agent] = giveWay
+}
+
+// Release drops every reservation of the agent
+func (t *ReservationTable) Release(agent int) {
+	for _, key := range t.byAgent[agent] {
+		if t.owners[key] == agent {
+			delete(t.owners, key)
+		}
+	}
+	delete(t.byAgent, agent)
+	delete(t.giveWay, agent)
+}
+
+// Purge forgets reservations of steps that are over. Nothing is reserved
+// in the past, so it only has work to do once per step.
+func (t *ReservationTable) Purge(beforeStep int) {
+	if beforeStep <= t.purged {
+		return
+	}
+	t.purged = beforeStep
+	for agent, keys := range t.byAgent {
+		kept := keys[:0]
+		for _, key := range keys {
+			if key.Step < beforeStep {
+				if t.owners[key] == agent {
+					delete(t.owners, key)
+				}
+				continue
+			}
+			kept = append(kept, key)
+		}
+		t.byAgent[agent] = kept
+	}
+}
+
+// stNode is a node of the space-time search
+type stNode struct {
+	Point  Point
+	Step   int // Steps since the start of the search
+	Parent *stNode
+	G, F   float64
+}
+
+// stNodeList implements a priority queue for the space-time search
+type stNodeList []*stNode
+
+func (nl stNodeList) Len() int { return len(nl) }
+func (nl stNodeList) Less(i, j int) bool {
+	if nl[i].F != nl[j].F {
+		return nl[i].F < nl[j].F
+	}
+	// Prefer nodes closer to the goal so ties resolve the same way every time
+	return nl[i].G > nl[j].G
+}
+func (nl stNodeList) Swap(i, j int) { nl[i], nl[j] = nl[j], nl[i] }
+
+func (nl *stNodeList) Push(x interface{}) {
+	*nl = append(*nl, x.(*stNode))
+}
+
+func (nl *stNodeList) Pop() interface{} {
+	old := *nl
+	n := len(old)
+	item := old[n-1]
+	*nl = old[0 : n-1]
+	return item
+}
+
+// findCooperativePath plans a path in space and time that avoids the tiles
+// other agents reserved. Waiting on a tile shows up as a repeated waypoint.
+// Agents that do not give way may pass through reservations of agents that
+// do on single-lane tiles; those agents are returned as bumped and must plan
+// again. If the reservations leave no way through, the plain path is
+// returned with scheduled set to false.
+func findCooperativePath(shrineMap [][]TileID, table *ReservationTable, agent int, start, goal Point,
+	startStep int, giveWay bool, trace *PathSearchTrace) (path []Point, bumped []int, scheduled bool, err error) {
+	// The plain search rejects impossible requests and bounds the horizon
+	plain, err := findPathTraced(shrineMap, start, goal, nil)
+	if err != nil {
+		return nil, nil, false, err
+	}
+	horizon := len(plain) + reservationExtraHorizon
+
+	// yields reports whether the agent holding a tile makes way for us
+	yields := func(owner int, p Point) bool {
+		return !giveWay && table.giveWay[owner] && isSingleLane(shrineMap, p)
+	}
+
+	openList := &stNodeList{}
+	heap.Init(openList)
+	closedList := make(map[reservationKey]bool)
+	heap.Push(openList, &stNode{
+		Point: start,
+		F:     manhattanDistance(start, goal),
+	})
+
+	// Down, Right, Up, Left and wait
+	moves := []Point{{0, 1}, {1, 0}, {0, -1}, {-1, 0}, {0, 0}}
+
+	for openList.Len() > 0 {
+		current := heap.Pop(openList).(*stNode)
+		key := reservationKey{current.Point, current.Step}
+		if closedList[key] {
+			continue
+		}
+		closedList[key] = true
+		if trace != nil {
+			trace.Steps = append(trace.Steps, PathSearchStep{Expanded: current.Point})
+		}
+
+		if current.Point == goal {
+			for node := current; node != nil; node = node.Parent {
+				path = append(path, node.Point)
+			}
+			for i := len(path)/2 - 1; i >= 0; i-- {
+				opp := len(path) - 1 - i
+				path[i], path[opp] = path[opp], path[i]
+			}
+
+			// Agents whose reservations we pass through have to plan again.
+			// The start tile is ours already, so only the tiles after it count,
+			// and only those of agents that make way.
+			seen := make(map[int]bool)
+			for i := 1; i < len(path); i++ {
+				p := path[i]
+				owner := table.owner(p, startStep+i)
+				if owner != 0 && owner != agent && yields(owner, p) && !seen[owner] {
+					seen[owner] = true
+					bumped = append(bumped, owner)
+					table.Release(owner)
+				}
+			}
+
+			table.Release(agent)
+			table.Reserve(agent, path, startStep, giveWay)
+			return path, bumped, true, nil
+		}
+
+		if current.Step >= horizon {
+			continue
+		}
+
+		for _, move := range moves {
+			next := Point{current.Point.X + move.X, current.Point.Y + move.Y}
+			step := current.Step + 1
+			if !isWalkable(shrineMap, next.X, next.Y) {
+				continue
+			}
+			if closedList[reservationKey{next, step}] {
+				continue
+			}
+
+			// Vertex conflict: someone else will stand there
+			if owner := table.owner(next, startStep+step); owner != 0 && owner != agent && !yields(owner, next) {
+				continue
+			}
+			// Edge conflict: someone walks the same edge the other way
+			if move != (Point{}) {
+				if owner := table.owner(next, startStep+current.Step); owner != 0 && owner != agent &&
+					table.owner(current.Point, startStep+step) == owner && !yields(owner, next) {
+					continue
+				}
+			}
+
+			g := current.G + 1
+			node := &stNode{
+				Point:  next,
+				Step:   step,
+				Parent: current,
+				G:      g,
+				F:      g + manhattanDistance(next, goal),
+			}
+			heap.Push(openList, node)
+			if trace != nil {
+				trace.addOpened(next)
+			}
+		}
+	}
+
+	// Boxed in by reservations: walk the plain path and rely on local steering
+	table.Release(agent)
+	table.Reserve(agent, plain, startStep, giveWay)
+	return plain, nil, false, nil
+}
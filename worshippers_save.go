@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"EdomaeElf/storage"
+)
+
+const (
+	saveName       = "worshippers_save.json" // Name the save is stored under
+	saveVersion    = 5                       // Bumped when the layout of SaveData changes
+	autosaveFrames = 3600                    // Frames between automatic saves (1 minute)
+)
+
+// SaveData is what the worshipper game keeps between sessions. A session
+// picks up the calendar where the last one left off; the last session's
+// starting point is kept as well so it can be replayed.
+type SaveData struct {
+	Version int   `json:"version"`
+	Seed    int64 `json:"seed"`    // Simulation seed of the last session
+	HasSeed bool  `json:"hasSeed"` // A session was saved, so Seed is its seed even if 0
+
+	StartClock     time.Time        `json:"startClock"`     // In-game time the last session started at
+	StartVisitorID int              `json:"startVisitorId"` // Last visitor ID handed out before it started
+	StartRegulars  []RegularVisitor `json:"startRegulars"`  // Visitor book as it was when it started
+
+	StartBoxCollected int `json:"startBoxCollected"` // Ledger entries collected from the donation box when it started
+
+	Clock      time.Time        `json:"clock"`      // In-game time when last saved, zero for the schedule's start
+	VisitorID  int              `json:"visitorId"`  // Last visitor ID handed out, so IDs stay unique across sessions
+	LedgerDays []LedgerDay      `json:"ledgerDays"` // Per-day totals of the older offerings
+	Ledger     []LedgerEntry    `json:"ledger"`     // Offerings since, one by one
+	Regulars   []RegularVisitor `json:"regulars"`   // Visitor book
+
+	BoxCollected int `json:"boxCollected"` // Ledger entries the miko has collected from the donation box
+}
+
+// GameOptions are the settings given on the command line, or as URL
+// parameters in the browser
+type GameOptions struct {
+	Seed    int64
+	HasSeed bool // Seed was given explicitly
+	Replay  bool // Reuse the seed of the last session from the save
+
+	Language string // Language of the speech bubbles, see speechFilePattern
+}
+
+// loadSave reads the save, or returns an empty one if there is none yet
+func loadSave() (*SaveData, error) {
+	data, err := storage.Load(saveName)
+	if errors.Is(err, storage.ErrNotFound) {
+		return &SaveData{Version: saveVersion}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var save SaveData
+	if err := json.Unmarshal(data, &save); err != nil {
+		return nil, fmt.Errorf("parsing save: %w", err)
+	}
+	if save.Version > saveVersion {
+		return nil, fmt.Errorf("save version %d is newer than this game (%d)", save.Version, saveVersion)
+	}
+	// Saves from before HasSeed used a zero seed for no session
+	if save.Version < 5 && save.Seed != 0 {
+		save.HasSeed = true
+	}
+	save.Version = saveVersion
+	return &save, nil
+}
+
+// writeSave stores the save. It is kept compact, since the browser allows only
+// a few megabytes of localStorage.
+func writeSave(save *SaveData) error {
+	data, err := json.Marshal(save)
+	if err != nil {
+		return err
+	}
+	return storage.Save(saveName, data)
+}
+
+// chooseSeed picks the simulation seed: the one given explicitly, the last
+// session's when replaying, or a new one
+func chooseSeed(options GameOptions, save *SaveData) int64 {
+	switch {
+	case options.HasSeed:
+		return options.Seed
+	case options.Replay && save.HasSeed:
+		return save.Seed
+	case options.Replay:
+		log.Printf("Warning: No previous session to replay, starting a new one")
+	}
+	return time.Now().UnixNano()
+}
+
+// isReplay reports whether the session replays the last one from the save
+func isReplay(options GameOptions, save *SaveData) bool {
+	return options.Replay && !options.HasSeed && save.HasSeed
+}
+
+// chooseStart picks the in-game time and the last visitor ID the session
+// starts from: the last session's start when replaying, otherwise where it
+// left off. A zero time means the schedule's start.
+func chooseStart(options GameOptions, save *SaveData) (time.Time, int) {
+	if isReplay(options, save) {
+		return save.StartClock, save.StartVisitorID
+	}
+	return save.Clock, save.VisitorID
+}
+
+// replayLedger returns the offerings made one by one before the replayed
+// session started, which the replay then makes again. The rolled up days are
+// all from before it started, see compactLedger.
+func replayLedger(save *SaveData) []LedgerEntry {
+	for i, e := range save.Ledger {
+		if !e.Time.Before(save.StartClock) {
+			return save.Ledger[:i:i]
+		}
+	}
+	return save.Ledger
+}
+
+// replayBoxCollected returns how much of the replayed ledger the miko had
+// collected from the donation box when the replayed session started
+func replayBoxCollected(save *SaveData, ledger *Ledger) int {
+	return min(save.StartBoxCollected, ledger.Len())
+}
+
+// save writes the game's persistent state. A replay leaves the save alone,
+// so it can be replayed again.
+func (g *MikoGameWithWorshippers) save() {
+	if g.replay {
+		return
+	}
+	g.saveData.Seed = g.seed
+	g.saveData.HasSeed = true
+	g.saveData.Clock = g.clock.Time
+	g.saveData.VisitorID = g.nextWorshipperID
+	g.compactLedger()
+	g.saveData.LedgerDays = g.ledger.Days
+	g.saveData.Ledger = g.ledger.Entries
+	g.saveData.Regulars = g.regulars.Snapshot()
+	g.saveData.BoxCollected = g.boxCollected
+	if err := writeSave(g.saveData); err != nil {
+		log.Printf("Warning: Could not save: %v", err)
+		g.notify("セーブできなかった")
+	}
+}
+
+// updateAutosave saves every autosaveFrames frames, since the browser gives
+// no chance to save when the page is closed
+func (g *MikoGameWithWorshippers) updateAutosave() {
+	g.framesSinceSave++
+	if g.framesSinceSave >= autosaveFrames {
+		g.framesSinceSave = 0
+		g.save()
+	}
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"math/rand"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// Speech bubble constants
+	speechFilePattern = "assets/data/speech_%s.json" // Lines for each language, see speechFile
+	defaultLanguage   = "ja"
+	maxSpeechBubbles  = 4    // Bubbles shown at once, more lines are dropped
+	speechFrames      = 180  // Frames a bubble stays up (3 seconds)
+	happyMoodAbove    = 0.7  // Visitors this happy say their happy lines
+	blossomRange      = 2    // Tiles from a cherry tree within which a visitor notices it
+	speechPadding     = 4    // Space between the text and the edge of the bubble
+	speechRaise       = 40.0 // Height of the bubble's bottom above the sprite's top
+)
+
+// Events that make a worshipper say something
+const (
+	SpeechArrive  = "arrive"  // Walked onto the map
+	SpeechReturn  = "return"  // Walked onto the map as a regular
+	SpeechPray    = "pray"    // Started praying at the donation box
+	SpeechBlossom = "blossom" // Came close to a cherry tree
+	SpeechGreeted = "greeted" // The miko said hello
+
+	SpeechDirections    = "directions"    // The miko showed the way
+	SpeechCharmBought   = "charmBought"   // Bought the omamori the miko offered
+	SpeechCharmDeclined = "charmDeclined" // Turned down the omamori the miko offered
+	SpeechScolded       = "scolded"       // Was told off for cutting in line
+)
+
+// Mood groups a line can be limited to
+const (
+	moodHappy   = "happy"
+	moodNeutral = "neutral"
+	moodUnhappy = "unhappy"
+)
+
+// cherryTreeTiles are the tiles of the cherry trees on the shrine map
+var cherryTreeTiles = map[TileID]bool{
+	{4, 4}: true, {5, 4}: true,
+	{6, 5}: true, {7, 5}: true,
+	{6, 6}: true, {7, 6}: true,
+	{6, 7}: true, {7, 7}: true,
+}
+
+// SpeechLine is something a worshipper may say when an event happens
+type SpeechLine struct {
+	Event      string   `json:"event"`
+	Archetypes []string `json:"archetypes"` // IDs of the archetypes that say it, anyone if empty
+	Mood       string   `json:"mood"`       // Mood group that says it, anyone if empty
+	Text       string   `json:"text"`
+}
+
+// speechFile is the layout of a speech data file
+type speechFile struct {
+	Lines []SpeechLine `json:"lines"`
+}
+
+// SpeechBubble is a line shown above a worshipper
+type SpeechBubble struct {
+	Worshipper *Worshipper
+	Text       string
+	Frames     int // Frames left on screen
+}
+
+// Speech picks the lines worshippers say and keeps the bubbles on screen.
+// Lines draw from their own random source, so the chatter never changes the
+// course of the simulation. The zero value says nothing.
+type Speech struct {
+	lines   []SpeechLine
+	rng     *rand.Rand
+	bubbles []SpeechBubble
+	matches []int // Candidate lines, reused between calls
+}
+
+// NewSpeech creates a speech system with the given lines
+func NewSpeech(lines []SpeechLine, seed int64) Speech {
+	return Speech{lines: lines, rng: rand.New(rand.NewSource(seed))}
+}
+
+// loadSpeechLines reads the lines for a language
+func loadSpeechLines(language string) ([]SpeechLine, error) {
+	path := fmt.Sprintf(speechFilePattern, language)
+	data, err := readDataFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var f speechFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	for _, line := range f.Lines {
+		switch line.Mood {
+		case "", moodHappy, moodNeutral, moodUnhappy:
+		default:
+			return nil, fmt.Errorf("%s: unknown mood %q", path, line.Mood)
+		}
+	}
+	return f.Lines, nil
+}
+
+// moodGroup sorts the worshipper's mood into happy, neutral or unhappy
+func (w *Worshipper) moodGroup() string {
+	switch {
+	case w.Mood >= happyMoodAbove:
+		return moodHappy
+	case w.Mood < unhappyMoodBelow:
+		return moodUnhappy
+	}
+	return moodNeutral
+}
+
+// matches reports whether the line fits the event and the worshipper
+func (line *SpeechLine) matches(event string, w *Worshipper) bool {
+	if line.Event != event {
+		return false
+	}
+	if line.Mood != "" && line.Mood != w.moodGroup() {
+		return false
+	}
+	if len(line.Archetypes) == 0 {
+		return true
+	}
+	if w.Archetype == nil {
+		return false
+	}
+	for _, id := range line.Archetypes {
+		if id == w.Archetype.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Say shows a line fitting the event above the worshipper and reports
+// whether there was room for it. A worshipper who is still talking
+// switches to the new line.
+func (s *Speech) Say(w *Worshipper, event string) bool {
+	s.matches = s.matches[:0]
+	for i := range s.lines {
+		if s.lines[i].matches(event, w) {
+			s.matches = append(s.matches, i)
+		}
+	}
+	if len(s.matches) == 0 {
+		return false
+	}
+	text := s.lines[s.matches[s.rng.Intn(len(s.matches))]].Text
+
+	for i := range s.bubbles {
+		if s.bubbles[i].Worshipper == w {
+			s.bubbles[i].Text = text
+			s.bubbles[i].Frames = speechFrames
+			return true
+		}
+	}
+	if len(s.bubbles) >= maxSpeechBubbles {
+		return false
+	}
+	s.bubbles = append(s.bubbles, SpeechBubble{Worshipper: w, Text: text, Frames: speechFrames})
+	return true
+}
+
+// Update counts down the bubbles once per frame and takes down the expired ones
+func (s *Speech) Update() {
+	kept := s.bubbles[:0]
+	for _, bubble := range s.bubbles {
+		bubble.Frames--
+		if bubble.Frames > 0 {
+			kept = append(kept, bubble)
+		}
+	}
+	s.bubbles = kept
+}
+
+// Forget takes down the bubble of a worshipper who left the map
+func (s *Speech) Forget(w *Worshipper) {
+	for i := range s.bubbles {
+		if s.bubbles[i].Worshipper == w {
+			s.bubbles = append(s.bubbles[:i], s.bubbles[i+1:]...)
+			return
+		}
+	}
+}
+
+// nearCherryTree reports whether a cherry tree is within blossomRange tiles
+func nearCherryTree(shrineMap [][]TileID, p Point) bool {
+	for y := p.Y - blossomRange; y <= p.Y+blossomRange; y++ {
+		for x := p.X - blossomRange; x <= p.X+blossomRange; x++ {
+			if y >= 0 && y < len(shrineMap) && x >= 0 && x < len(shrineMap[y]) && cherryTreeTiles[shrineMap[y][x]] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// updateSpeech makes worshippers comment on arriving and on the cherry trees.
+// Regulars say they are back, if there is a line for it.
+func (g *MikoGameWithWorshippers) updateSpeech() {
+	mapWidth := float64(mikoMapWidth) * mikoTileSize * mikoScaleFactor
+	for _, w := range g.worshippers.All() {
+		if w.State == StateLeaving {
+			continue
+		}
+		if !w.Arrived && w.X >= 0 && w.X < mapWidth {
+			w.Arrived = true
+			if w.Regular == nil || !g.speech.Say(w, SpeechReturn) {
+				g.speech.Say(w, SpeechArrive)
+			}
+		}
+		if !w.SawBlossoms && nearCherryTree(g.shrineMap, pixelToTile(worshipperCenter(w))) {
+			w.SawBlossoms = true
+			g.speech.Say(w, SpeechBlossom)
+		}
+	}
+}
+
+// drawSpeechBubbles draws the lines worshippers are saying above their heads
+func (g *MikoGameWithWorshippers) drawSpeechBubbles(screen *ebiten.Image) {
+	for _, bubble := range g.speech.bubbles {
+		w := bubble.Worshipper
+		size := spriteSize(w.Image, w.Scale)
+		width := textWidth(bubble.Text) + 2*speechPadding
+		height := float64(textLineHeight + speechPadding)
+		x := w.X - g.cameraX + size/2 - width/2
+		y := w.Y - g.cameraY - speechRaise - height
+
+		ebitenutil.DrawRect(screen, x, y, width, height, color.RGBA{0, 0, 0, 180})
+		ebitenutil.DrawRect(screen, x+width/2-3, y+height, 6, 6, color.RGBA{0, 0, 0, 180})
+		drawText(screen, bubble.Text, x+speechPadding, y+speechPadding/2)
+	}
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"math"
+)
+
+const (
+	// Local steering constants
+	steeringCellSize       = 32.0  // Spatial grid cell size in pixels (half a map tile)
+	steeringNearRadius     = 32.0  // Neighbors are searched this close first, then this much further at a time
+	steeringNeighborRadius = 96.0  // Only agents closer than this are considered
+	steeringMaxNeighbors   = 16    // Only this many of the closest agents are considered in a crowd
+	worshipperRadius       = 14.0  // Personal space of a worshipper
+	playerRadius           = 20.0  // Personal space the miko needs
+	separationWeight       = 0.6   // Strength of the push between overlapping agents
+	avoidanceTimeHorizon   = 60.0  // Frames to look ahead for collisions
+	avoidanceCollisionCost = 120.0 // Penalty weight for an imminent collision
+)
+
+// avoidanceAngles are the headings tried around the preferred velocity, in radians
+var avoidanceAngles = []float64{0, 0.26, -0.26, 0.52, -0.52, 0.79, -0.79, 1.05, -1.05, 1.57, -1.57}
+
+// avoidanceSpeedFactors are the speeds tried for every heading, relative to the preferred speed
+var avoidanceSpeedFactors = []float64{1.0, 0.5}
+
+// avoidanceTurns holds the cosine and sine of every avoidance angle, so
+// candidates are rotations of the preferred velocity without trigonometry
+var avoidanceTurns = func() [][2]float64 {
+	turns := make([][2]float64, len(avoidanceAngles))
+	for i, angle := range avoidanceAngles {
+		turns[i] = [2]float64{math.Cos(angle), math.Sin(angle)}
+	}
+	return turns
+}()
+
+// steeringAgent is the view of a moving body that the steering layer works on
+type steeringAgent struct {
+	X, Y   float64 // Center position in pixels
+	VX, VY float64 // Velocity in pixels per frame
+	Radius float64
+	Static bool // Static agents are obstacles but never steer themselves
+}
+
+// Neighbor is an agent found by a spatial grid query
+type Neighbor struct {
+	Index      int
+	DistanceSq float64 // Squared distance from the queried position
+}
+
+// gridEntry is an inserted agent with its position, kept together so a
+// query reads the agents of a cell from consecutive memory
+type gridEntry struct {
+	X, Y  float64
+	Index int
+}
+
+// SpatialGrid buckets agents into the cells of a fixed grid over the map so
+// neighbor queries only visit nearby cells instead of every agent on the
+// map. Positions off the map fall into the border cells. The grid is
+// rebuilt every tick by sorting the inserted agents by cell into flat
+// arrays, which allocates nothing once the arrays have grown.
+type SpatialGrid struct {
+	cellSize   float64
+	cols, rows int
+	inserted   []gridEntry
+	cells      []int32     // Cell of each inserted agent
+	start      []int32     // Where each cell's agents begin in sorted, plus the end
+	sorted     []gridEntry // Inserted agents grouped by cell, in insertion order within a cell
+}
+
+// NewSpatialGrid creates an empty grid with the given cell size over a map
+// of the given size in pixels
+func NewSpatialGrid(cellSize, width, height float64) *SpatialGrid {
+	cols := int(math.Ceil(width/cellSize)) + 2
+	rows := int(math.Ceil(height/cellSize)) + 2
+	return &SpatialGrid{
+		cellSize: cellSize,
+		cols:     cols,
+		rows:     rows,
+		start:    make([]int32, cols*rows+1),
+	}
+}
+
+// cellAt returns the column and row of a position, one cell of margin
+// around the map and clamped to the grid
+func (h *SpatialGrid) cellAt(x, y float64) (int, int) {
+	col := int(math.Floor(x/h.cellSize)) + 1
+	row := int(math.Floor(y/h.cellSize)) + 1
+	return min(max(col, 0), h.cols-1), min(max(row, 0), h.rows-1)
+}
+
+// Clear empties the grid while keeping the arrays for reuse
+func (h *SpatialGrid) Clear() {
+	h.inserted = h.inserted[:0]
+	h.cells = h.cells[:0]
+}
+
+// Insert adds the next agent at the given position. Agents are numbered in
+// insertion order, starting at 0.
+func (h *SpatialGrid) Insert(x, y float64) {
+	col, row := h.cellAt(x, y)
+	h.inserted = append(h.inserted, gridEntry{X: x, Y: y, Index: len(h.inserted)})
+	h.cells = append(h.cells, int32(row*h.cols+col))
+}
+
+// Build sorts the inserted agents by cell. Call it after the last Insert
+// and before the first Query.
+func (h *SpatialGrid) Build() {
+	clear(h.start)
+	for _, cell := range h.cells {
+		h.start[cell+1]++
+	}
+	for i := 1; i < len(h.start); i++ {
+		h.start[i] += h.start[i-1]
+	}
+	if cap(h.sorted) < len(h.inserted) {
+		h.sorted = make([]gridEntry, len(h.inserted))
+	}
+	h.sorted = h.sorted[:len(h.inserted)]
+	next := h.start[:len(h.start)-1]
+	for i, cell := range h.cells {
+		h.sorted[next[cell]] = h.inserted[i]
+		next[cell]++
+	}
+	// Filling the cells moved every start to the next cell's
+	copy(h.start[1:], h.start)
+	h.start[0] = 0
+}
+
+// Query appends to dst every agent within the radius of the given position,
+// cell by cell. Each row of cells is only searched as far as the circle
+// reaches into it.
+func (h *SpatialGrid) Query(x, y, radius float64, dst []Neighbor) []Neighbor {
+	_, minRow := h.cellAt(x, y-radius)
+	_, maxRow := h.cellAt(x, y+radius)
+	radiusSq := radius * radius
+	for row := minRow; row <= maxRow; row++ {
+		// Distance from the position to the nearest edge of the row
+		top := float64(row-1) * h.cellSize
+		dy := math.Max(0, math.Max(top-y, y-(top+h.cellSize)))
+		if row == 0 || row == h.rows-1 {
+			dy = 0 // Border rows reach to infinity
+		}
+		if dy >= radius {
+			continue
+		}
+		reach := math.Sqrt(radiusSq - dy*dy)
+		minCol, _ := h.cellAt(x-reach, y)
+		maxCol, _ := h.cellAt(x+reach, y)
+
+		first, last := h.start[row*h.cols+minCol], h.start[row*h.cols+maxCol+1]
+		for _, e := range h.sorted[first:last] {
+			dx, dy := e.X-x, e.Y-y
+			if d := dx*dx + dy*dy; d < radiusSq {
+				dst = append(dst, Neighbor{Index: e.Index, DistanceSq: d})
+			}
+		}
+	}
+	return dst
+}
+
+// timeToCollision returns the number of frames until two discs moving with
+// constant velocities touch, or +Inf if they never do within the horizon
+func timeToCollision(px, py, vx, vy, radius float64) float64 {
+	// Solve |p + v*t| = radius for the smallest positive t
+	a := vx*vx + vy*vy
+	b := px*vx + py*vy
+	c := px*px + py*py - radius*radius
+	if c < 0 {
+		// Already overlapping
+		return 0
+	}
+	if a == 0 || b >= 0 {
+		return math.Inf(1)
+	}
+	discriminant := b*b - a*c
+	if discriminant < 0 {
+		return math.Inf(1)
+	}
+	t := (-b - math.Sqrt(discriminant)) / a
+	if t > avoidanceTimeHorizon {
+		return math.Inf(1)
+	}
+	return t
+}
+
+// steerVelocity picks a collision-free velocity close to the preferred one.
+// Candidate velocities are sampled around the preferred heading and scored by
+// their deviation plus a penalty for imminent collisions (a sampled velocity
+// obstacle), then a separation push is added for agents that already overlap.
+// Scoring a candidate stops as soon as it costs more than the best so far,
+// which in open space is the preferred velocity itself.
+func steerVelocity(agents []steeringAgent, self int, neighbors []int, prefVX, prefVY float64) (float64, float64) {
+	agent := agents[self]
+	prefSpeed := math.Sqrt(prefVX*prefVX + prefVY*prefVY)
+	if prefSpeed == 0 {
+		return 0, 0
+	}
+
+	// Neighbors that already overlap cost every candidate the same, so only
+	// the separation push below deals with them
+	approaching := make([]int, 0, steeringMaxNeighbors)
+	for _, n := range neighbors {
+		other := agents[n]
+		dx, dy, r := other.X-agent.X, other.Y-agent.Y, agent.Radius+other.Radius
+		if n != self && dx*dx+dy*dy >= r*r {
+			approaching = append(approaching, n)
+		}
+	}
+
+	bestVX, bestVY := 0.0, 0.0
+	bestCost := math.Inf(1)
+	for _, speedFactor := range avoidanceSpeedFactors {
+		for _, turn := range avoidanceTurns {
+			vx := (prefVX*turn[0] - prefVY*turn[1]) * speedFactor
+			vy := (prefVX*turn[1] + prefVY*turn[0]) * speedFactor
+
+			cost := math.Sqrt((vx-prefVX)*(vx-prefVX) + (vy-prefVY)*(vy-prefVY))
+			for _, n := range approaching {
+				if cost >= bestCost {
+					break
+				}
+				other := agents[n]
+				// Reciprocal avoidance: each moving agent takes half of the
+				// responsibility, static obstacles leave it all to us
+				relVX, relVY := vx-other.VX, vy-other.VY
+				if !other.Static {
+					relVX = 2*vx - agent.VX - other.VX
+					relVY = 2*vy - agent.VY - other.VY
+				}
+				t := timeToCollision(other.X-agent.X, other.Y-agent.Y, -relVX, -relVY, agent.Radius+other.Radius)
+				if !math.IsInf(t, 1) {
+					cost += avoidanceCollisionCost / (t + 1)
+				}
+			}
+
+			if cost < bestCost {
+				bestCost = cost
+				bestVX, bestVY = vx, vy
+			}
+		}
+	}
+
+	// Separation keeps agents that already overlap from stacking up
+	for _, n := range neighbors {
+		if n == self {
+			continue
+		}
+		other := agents[n]
+		dx := agent.X - other.X
+		dy := agent.Y - other.Y
+		distance := math.Sqrt(dx*dx + dy*dy)
+		minDistance := agent.Radius + other.Radius
+		if distance >= minDistance {
+			continue
+		}
+		if distance == 0 {
+			// Exactly on top of each other: push apart along the index order
+			// so that the result stays deterministic
+			dx, dy, distance = float64(self-n), 0, 1
+		}
+		push := (minDistance - distance) / minDistance * separationWeight
+		bestVX += dx / distance * push
+		bestVY += dy / distance * push
+	}
+
+	// Never move faster than the agent wants to
+	speed := math.Sqrt(bestVX*bestVX + bestVY*bestVY)
+	if speed > prefSpeed {
+		bestVX = bestVX / speed * prefSpeed
+		bestVY = bestVY / speed * prefSpeed
+	}
+
+	return bestVX, bestVY
+}
+
+// worshipperCenter returns the center of the drawn worshipper sprite
+func worshipperCenter(w *Worshipper) (float64, float64) {
+	size := spriteSize(w.Image, w.Scale)
+	return w.X + size/2, w.Y + size/2
+}
+
+// playerCenter returns the center of the drawn player sprite
+func playerCenter(p *Player) (float64, float64) {
+	size := spriteSize(p.Image, playerSpriteScale)
+	return p.X + size/2, p.Y + size/2
+}
+
+// closestNeighbors picks the steeringMaxNeighbors agents closest to agent
+// self from the agents a grid query found around it, closest first, and
+// appends them to dst
+func closestNeighbors(found []Neighbor, self int, dst []int) []int {
+	var closest [steeringMaxNeighbors]Neighbor
+	n := 0
+	for _, f := range found {
+		if f.Index == self || f.DistanceSq >= steeringNeighborRadius*steeringNeighborRadius {
+			continue
+		}
+		if n == steeringMaxNeighbors && f.DistanceSq >= closest[n-1].DistanceSq {
+			continue
+		}
+
+		// Insert in order, dropping the farthest once full. Ties keep the
+		// order of the query.
+		i := min(n, steeringMaxNeighbors-1)
+		for ; i > 0 && closest[i-1].DistanceSq > f.DistanceSq; i-- {
+			closest[i] = closest[i-1]
+		}
+		closest[i] = f
+		n = min(n+1, steeringMaxNeighbors)
+	}
+	for _, c := range closest[:n] {
+		dst = append(dst, c.Index)
+	}
+	return dst
+}
+
+// steerWorshippers resolves the preferred velocities set by Worshipper.Update
+// into actual movement that avoids other worshippers and the player
+func (g *MikoGameWithWorshippers) steerWorshippers() {
+	if g.steeringGrid == nil {
+		g.steeringGrid = NewSpatialGrid(steeringCellSize,
+			float64(mikoMapWidth)*mikoTileSize*mikoScaleFactor, float64(mikoMapHeight)*mikoTileSize*mikoScaleFactor)
+	}
+	g.steeringGrid.Clear()
+	g.steeringAgents = g.steeringAgents[:0]
+
+	worshippers := g.worshippers.All()
+	for _, w := range worshippers {
+		cx, cy := worshipperCenter(w)
+		g.steeringAgents = append(g.steeringAgents, steeringAgent{
+			X:      cx,
+			Y:      cy,
+			VX:     w.VX,
+			VY:     w.VY,
+			Radius: worshipperRadius,
+			Static: w.PrefVX == 0 && w.PrefVY == 0,
+		})
+		g.steeringGrid.Insert(cx, cy)
+	}
+
+	// The player is an obstacle worshippers make room for
+	if !g.editMode {
+		px, py := playerCenter(g.player)
+		g.steeringAgents = append(g.steeringAgents, steeringAgent{
+			X:      px,
+			Y:      py,
+			VX:     g.player.VX,
+			VY:     g.player.VY,
+			Radius: playerRadius,
+			Static: true,
+		})
+		g.steeringGrid.Insert(px, py)
+	}
+	g.steeringGrid.Build()
+
+	for i, w := range worshippers {
+		if g.steeringAgents[i].Static {
+			w.VX, w.VY = 0, 0
+			continue
+		}
+		// Search close by first and further out only while too few neighbors
+		// turn up. Once enough do, they are the closest a wider search would
+		// have found too.
+		agent := g.steeringAgents[i]
+		for radius := steeringNearRadius; ; radius += steeringNearRadius {
+			radius = math.Min(radius, steeringNeighborRadius)
+			g.foundBuffer = g.steeringGrid.Query(agent.X, agent.Y, radius, g.foundBuffer[:0])
+			g.neighborBuffer = closestNeighbors(g.foundBuffer, i, g.neighborBuffer[:0])
+			if len(g.neighborBuffer) == steeringMaxNeighbors || radius == steeringNeighborRadius {
+				break
+			}
+		}
+		w.VX, w.VY = steerVelocity(g.steeringAgents, i, g.neighborBuffer, w.PrefVX, w.PrefVY)
+	}
+
+	// Integrate after all velocities are chosen so every agent sees the same
+	// frame. Each axis is checked against the map on its own, so that making
+	// room never pushes a visitor into a wall or off the stairs; where the
+	// visitor was headed anyway, such as a praying slot, they still go.
+	for _, w := range worshippers {
+		if offTrack(g.shrineMap, w.X, w.Y, w.X+w.VX, w.Y) && !offTrack(g.shrineMap, w.X, w.Y, w.X+w.PrefVX, w.Y) {
+			w.VX = 0
+		}
+		w.X += w.VX
+		if offTrack(g.shrineMap, w.X, w.Y, w.X, w.Y+w.VY) && !offTrack(g.shrineMap, w.X, w.Y, w.X, w.Y+w.PrefVY) {
+			w.VY = 0
+		}
+		w.Y += w.VY
+	}
+}
+
+// offTrack reports whether (x, y) lies on a blocked tile other than the one
+// at (fromX, fromY). Off the map is where visitors come from and go to, so
+// it is never blocked.
+func offTrack(shrineMap [][]TileID, fromX, fromY, x, y float64) bool {
+	if x < 0 || y < 0 {
+		return false
+	}
+	p := pixelToTile(x, y)
+	if p.X >= mikoMapWidth || p.Y >= mikoMapHeight || p == pixelToTile(fromX, fromY) {
+		return false
+	}
+	return !isWalkable(shrineMap, p.X, p.Y)
+}
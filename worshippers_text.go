@@ -0,0 +1,28 @@
+package main
+
+import (
+	"github.com/hajimehoshi/bitmapfont/v3"
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/text/v2"
+)
+
+// textLineHeight is the height of a line of text drawn with drawText
+const textLineHeight = 16
+
+// textFace is the font of labels and bubbles. Unlike the debug font, which
+// stops at Latin-1, it has the Japanese characters.
+var textFace = text.NewGoXFace(bitmapfont.Face)
+
+// drawText writes s in white with its top left corner at (x, y)
+func drawText(screen *ebiten.Image, s string, x, y float64) {
+	op := &text.DrawOptions{}
+	op.GeoM.Translate(x, y)
+	op.LineSpacing = textLineHeight
+	text.Draw(screen, s, textFace, op)
+}
+
+// textWidth returns the width of the longest line of s in pixels
+func textWidth(s string) float64 {
+	width, _ := text.Measure(s, textFace, textLineHeight)
+	return width
+}
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"fmt"
+	"image/color"
+	"math"
+	"time"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+)
+
+const (
+	// Tile action constants
+	tileReach    = 24.0                               // How far past her hitbox the miko reaches the tile she faces
+	suzuRange    = 3 * mikoTileSize * mikoScaleFactor // Visitors this close to the sacred tree hear the bell
+	suzuMood     = 0.1                                // Mood each of them gains
+	suzuCooldown = 10 * time.Minute                   // In-game time before the bell lifts their mood again
+)
+
+// TileAction is something the miko can do at a kind of tile, when she
+// faces it and presses the interact action, or once she has walked up to
+// it after a click
+type TileAction struct {
+	Name  string  // Shown in the HUD prompt and while she walks there
+	Reach float64 // How far past her hitbox the tile may be for her to do it
+	Do    func(g *MikoGameWithWorshippers, p Point)
+}
+
+// tileActions are the tiles the miko can do something at, by tile kind
+var tileActions = map[TileID]TileAction{
+	{1, 4}: {Name: "賽銭を回収する", Reach: tileReach, Do: (*MikoGameWithWorshippers).collectOfferings},
+	{2, 4}: {Name: "手を清める", Reach: tileReach, Do: (*MikoGameWithWorshippers).purifyHands},
+	{3, 1}: {Name: "鈴を鳴らす", Reach: tileReach, Do: (*MikoGameWithWorshippers).ringSuzu},
+	{4, 1}: {Name: "拝殿に入る", Reach: tileReach, Do: (*MikoGameWithWorshippers).enterHaiden},
+}
+
+// collectOfferings empties the donation box of what was offered since the
+// miko last emptied it
+func (g *MikoGameWithWorshippers) collectOfferings(Point) {
+	yen := g.offeringsInBox()
+	if yen == 0 {
+		g.notify("巫女: 賽銭箱は空だった")
+		return
+	}
+	g.boxCollected = g.ledger.Len()
+	g.notify(fmt.Sprintf("巫女: 賽銭箱から%d円を回収した", yen))
+}
+
+// purifyHands has the miko rinse her hands and mouth at the temizuya, which
+// uses its water like a visitor does
+func (g *MikoGameWithWorshippers) purifyHands(Point) {
+	if !g.chores.Use(ChoreTemizuya, temizuyaWaterPerUse) {
+		g.notify("手水鉢に水がない (補充が必要)")
+		return
+	}
+	g.notify("巫女: 手水で手と口を清めた")
+}
+
+// ringSuzu has the miko shake the kagura bells before the sacred tree,
+// which cheers the visitors within earshot unless she just did
+func (g *MikoGameWithWorshippers) ringSuzu(p Point) {
+	if !g.suzuRungAt.IsZero() && g.clock.Time.Before(g.suzuRungAt.Add(suzuCooldown)) {
+		g.notify("巫女: 鈴を鳴らした (さっき鳴らしたばかり)")
+		return
+	}
+	g.suzuRungAt = g.clock.Time
+
+	tx, ty := tileToPixel(p)
+	listeners := 0
+	for _, w := range g.worshippers.All() {
+		wx, wy := worshipperCenter(w)
+		if w.State != StateLeaving && math.Hypot(wx-tx, wy-ty) <= suzuRange {
+			w.changeMood(suzuMood)
+			listeners++
+		}
+	}
+	g.notify(fmt.Sprintf("巫女: 御神木の前で鈴を鳴らした (%d人が聞き入った)", listeners))
+}
+
+// enterHaiden takes the miko into the haiden, out of sight until she leaves
+func (g *MikoGameWithWorshippers) enterHaiden(Point) {
+	g.player.Inside = true
+	g.route = nil
+	g.interaction.Target = nil
+	g.chores.Working = nil
+	g.notify("巫女: 拝殿に入った")
+}
+
+// reaches reports whether the miko's hitbox comes within reach of a tile
+func (g *MikoGameWithWorshippers) reaches(p Point, reach float64) bool {
+	const size = mikoTileSize * mikoScaleFactor
+	x0, y0, x1, y1 := g.player.Hitbox()
+	tx, ty := float64(p.X)*size, float64(p.Y)*size
+	return x0-reach < tx+size && x1+reach > tx && y0-reach < ty+size && y1+reach > ty
+}
+
+// facedTile returns the tile with an action the miko faces within reach, the
+// one nearest the middle of the side of her hitbox she faces, or false if
+// there is none. The strip searched is a little wider than her hitbox, so
+// she can reach a tile she cannot stand right in front of.
+func (g *MikoGameWithWorshippers) facedTile() (Point, bool) {
+	const tile = mikoTileSize * mikoScaleFactor
+	hx0, hy0, hx1, hy1 := g.player.Hitbox()
+	x0, y0, x1, y1 := hx0-tileReach, hy0-tileReach, hx1+tileReach, hy1+tileReach
+	var ex, ey float64 // Middle of the side she faces
+	switch g.player.Facing {
+	case FacingUp:
+		y1, ex, ey = hy0, (hx0+hx1)/2, hy0
+	case FacingDown:
+		y0, ex, ey = hy1, (hx0+hx1)/2, hy1
+	case FacingLeft:
+		x1, ex, ey = hx0, hx0, (hy0+hy1)/2
+	case FacingRight:
+		x0, ex, ey = hx1, hx1, (hy0+hy1)/2
+	}
+
+	var faced Point
+	found, nearest := false, math.Inf(1)
+	for y := int(math.Floor(y0 / tile)); y < int(math.Ceil(y1/tile)); y++ {
+		for x := int(math.Floor(x0 / tile)); x < int(math.Ceil(x1/tile)); x++ {
+			p := Point{x, y}
+			if !isValidPosition(p) {
+				continue
+			}
+			if _, ok := tileActions[g.shrineMap[y][x]]; !ok {
+				continue
+			}
+			tx, ty := tileToPixel(p)
+			if d := math.Hypot(tx-ex, ty-ey); d < nearest {
+				faced, found, nearest = p, true, d
+			}
+		}
+	}
+	return faced, found
+}
+
+// facedTileAction returns the action of the tile the miko faces and the
+// tile, nil if she faces none or is inside the haiden
+func (g *MikoGameWithWorshippers) facedTileAction() (*TileAction, Point) {
+	if g.player.Inside {
+		return nil, Point{}
+	}
+	p, ok := g.facedTile()
+	if !ok {
+		return nil, Point{}
+	}
+	action := tileActions[g.shrineMap[p.Y][p.X]]
+	return &action, p
+}
+
+// updateTileActions carries out the action of the tile the miko faces when
+// the interact action is pressed, and brings her out of the haiden. It
+// reports whether it took the interact action, so it does not also talk to
+// a visitor.
+func (g *MikoGameWithWorshippers) updateTileActions() bool {
+	if g.player.Inside {
+		if g.input.JustPressed(InputInteract) || g.input.JustPressed(InputCancel) {
+			g.player.Inside = false
+			g.notify("巫女: 拝殿から出た")
+		}
+		return true
+	}
+	if g.interaction.Target != nil || !g.input.JustPressed(InputInteract) {
+		return false
+	}
+	action, p := g.facedTileAction()
+	if action == nil {
+		return false
+	}
+	action.Do(g, p)
+	return true
+}
+
+// tileActionHUD returns the HUD prompt for the tile the miko faces
+func (g *MikoGameWithWorshippers) tileActionHUD() string {
+	key := g.input.Label(InputInteract)
+	if g.player.Inside {
+		return fmt.Sprintf("\n[拝殿の中]\n%s: 拝殿から出る\n", key)
+	}
+	if g.interaction.Target != nil {
+		return ""
+	}
+	if action, _ := g.facedTileAction(); action != nil {
+		return fmt.Sprintf("%s: %s\n", key, action.Name)
+	}
+	return ""
+}
+
+// offeringsInBox returns the yen offered since the miko last emptied the
+// donation box
+func (g *MikoGameWithWorshippers) offeringsInBox() int {
+	return g.ledger.After(g.boxCollected)
+}
+
+// offeringsHUD returns the HUD line of what is in the donation box
+func (g *MikoGameWithWorshippers) offeringsHUD() string {
+	return fmt.Sprintf("賽銭箱の中: %d円\n", g.offeringsInBox())
+}
+
+// drawFacedTile outlines the tile the interact action would use
+func (g *MikoGameWithWorshippers) drawFacedTile(screen *ebiten.Image) {
+	if g.editMode || g.interaction.Target != nil {
+		return
+	}
+	action, p := g.facedTileAction()
+	if action == nil {
+		return
+	}
+	const size = mikoTileSize * mikoScaleFactor
+	x, y := float64(p.X)*size-g.cameraX, float64(p.Y)*size-g.cameraY
+	clr := color.RGBA{255, 255, 255, 160}
+	ebitenutil.DrawRect(screen, x, y, size, 2, clr)
+	ebitenutil.DrawRect(screen, x, y+size-2, size, 2, clr)
+	ebitenutil.DrawRect(screen, x, y, 2, size, clr)
+	ebitenutil.DrawRect(screen, x+size-2, y, 2, size, clr)
+}
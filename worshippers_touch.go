@@ -0,0 +1,375 @@
+package main
+
+import (
+	"image/color"
+	"math"
+
+	"github.com/hajimehoshi/ebiten/v2"
+	"github.com/hajimehoshi/ebiten/v2/ebitenutil"
+	"github.com/hajimehoshi/ebiten/v2/inpututil"
+
+	"EdomaeElf/input"
+)
+
+const (
+	// Touch control constants
+	touchStickX       = 140.0 // Center of the joystick's base
+	touchStickY       = mikoScreenHeight - 140.0
+	touchStickRadius  = 80.0  // Knob offset at which the miko walks at full speed
+	touchStickGrab    = 150.0 // A finger put down this close to the base takes the joystick
+	touchButtonWidth  = 180.0
+	touchButtonHeight = 56.0
+	touchButtonGap    = 10.0
+	touchButtonMargin = 20.0 // Between the buttons and the edge of the screen
+	touchTapFrames    = 20   // A finger lifted within this many frames...
+	touchTapSlop      = 16.0 // ...having moved less than this is a tap
+	touchPaintFrames  = 8    // In the editor a finger held this long places tiles, unless a second one joins it to pinch
+	touchZoomMin      = 1.0
+	touchZoomMax      = 3.0
+)
+
+// touchPoint is a finger on the screen this frame
+type touchPoint struct {
+	ID   ebiten.TouchID
+	X, Y int
+}
+
+// touchState follows a finger from when it touched the screen
+type touchState struct {
+	StartX, StartY int
+	X, Y           int
+	Frames         int
+	Moved          bool        // Went further than touchTapSlop from where it started
+	Button         bool        // Put down on a button, holding Action down
+	Action         InputAction // The button's action when the finger went down, even if the buttons change under it
+	Pinched        bool        // Was one of the two fingers of a pinch
+	seen           bool        // Still on the screen this frame
+}
+
+// touchButton is an on-screen button that holds an action down
+type touchButton struct {
+	Action InputAction
+	Label  string
+	X, Y   float64
+}
+
+// TouchControls are the on-screen joystick and buttons for phones and
+// tablets. A tap walks the miko there like a click, pinching zooms and, in
+// the editor, two fingers pan the zoomed view.
+type TouchControls struct {
+	Enabled bool    // The screen was touched since the mouse or keyboard were last used
+	Zoom    float64 // 1 shows the whole screen
+	ViewX   float64 // Top left of the zoomed view, in unzoomed screen pixels
+	ViewY   float64
+
+	touches   map[ebiten.TouchID]*touchState
+	buttons   []touchButton
+	stick     ebiten.TouchID
+	stickHeld bool
+	stickX    float64 // Knob offset from the base, at most touchStickRadius
+	stickY    float64
+	pinching  bool
+	pinchDist float64 // Between the two fingers last frame
+	pinchX    float64 // Midpoint of the two fingers last frame
+	pinchY    float64
+	tapped    bool // A finger tapped the screen this frame, at tapX, tapY
+	tapX      int
+	tapY      int
+	placing   bool // A finger is placing tiles in the editor, at placeX, placeY
+	placeX    int
+	placeY    int
+	layer     *ebiten.Image // The world drawn unzoomed, while zoomed in
+}
+
+// touchPoints returns the fingers on the screen
+func touchPoints() []touchPoint {
+	var points []touchPoint
+	for _, id := range ebiten.AppendTouchIDs(nil) {
+		x, y := ebiten.TouchPosition(id)
+		points = append(points, touchPoint{ID: id, X: x, Y: y})
+	}
+	return points
+}
+
+// updateTouch reads the touch screen. It runs before the actions are read,
+// so the on-screen controls can hold them down.
+func (g *MikoGameWithWorshippers) updateTouch() {
+	points := touchPoints()
+	if len(points) > 0 {
+		g.touch.Enabled = true
+	} else if inpututil.IsMouseButtonJustPressed(ebiten.MouseButtonLeft) || len(inpututil.AppendJustPressedKeys(nil)) > 0 {
+		// Back at a desk, so the controls would only be in the way
+		g.touch.Enabled = false
+	}
+	g.updateTouchPoints(points)
+}
+
+// touchControlsShown reports whether the joystick and buttons are on screen
+func (g *MikoGameWithWorshippers) touchControlsShown() bool {
+	return g.touch.Enabled && !g.rebind.Open
+}
+
+// touchStickShown reports whether the joystick is on screen. It walks the
+// miko, so there is none in the editor or over the visitor book.
+func (g *MikoGameWithWorshippers) touchStickShown() bool {
+	return !g.editMode && !g.visitorBook.Open
+}
+
+// updateTouchPoints follows the fingers on the screen and turns them into
+// actions, a tap, tile placement, zoom and pan
+func (g *MikoGameWithWorshippers) updateTouchPoints(points []touchPoint) {
+	t := &g.touch
+	if t.touches == nil {
+		t.touches = make(map[ebiten.TouchID]*touchState)
+	}
+	t.buttons = g.touchButtons()
+	t.tapped, t.placing = false, false
+
+	for _, s := range t.touches {
+		s.seen = false
+	}
+	var free []*touchState // Fingers on the map rather than on the controls
+	for _, p := range points {
+		s, ok := t.touches[p.ID]
+		if !ok {
+			s = &touchState{StartX: p.X, StartY: p.Y}
+			t.touches[p.ID] = s
+			g.claimTouch(p, s)
+		}
+		s.X, s.Y, s.seen = p.X, p.Y, true
+		s.Frames++
+		if math.Hypot(float64(s.X-s.StartX), float64(s.Y-s.StartY)) > touchTapSlop {
+			s.Moved = true
+		}
+		switch {
+		case t.stickHeld && p.ID == t.stick:
+			t.stickX, t.stickY = float64(p.X)-touchStickX, float64(p.Y)-touchStickY
+			if d := math.Hypot(t.stickX, t.stickY); d > touchStickRadius {
+				t.stickX, t.stickY = t.stickX*touchStickRadius/d, t.stickY*touchStickRadius/d
+			}
+		case !s.Button:
+			free = append(free, s)
+		}
+	}
+
+	// Fingers lifted. A quick touch that stayed put is a tap.
+	for id, s := range t.touches {
+		if s.seen {
+			continue
+		}
+		delete(t.touches, id)
+		if t.stickHeld && id == t.stick {
+			t.stickHeld, t.stickX, t.stickY = false, 0, 0
+			continue
+		}
+		if !s.Button && !s.Pinched && !s.Moved && s.Frames <= touchTapFrames {
+			t.tapped, t.tapX, t.tapY = true, s.X, s.Y
+		}
+	}
+
+	// Two fingers on the map pinch to zoom and, in the editor, pan
+	if len(free) >= 2 {
+		a, b := free[0], free[1]
+		a.Pinched, b.Pinched = true, true
+		dist := math.Hypot(float64(a.X-b.X), float64(a.Y-b.Y))
+		mx, my := float64(a.X+b.X)/2, float64(a.Y+b.Y)/2
+		if t.pinching && t.pinchDist > 0 {
+			t.zoomAt(t.Zoom*dist/t.pinchDist, t.pinchX, t.pinchY)
+			if g.editMode {
+				t.pan(mx-t.pinchX, my-t.pinchY)
+			}
+		}
+		t.pinching, t.pinchDist, t.pinchX, t.pinchY = true, dist, mx, my
+	} else {
+		t.pinching = false
+	}
+
+	// One finger on the map places tiles in the editor, held or tapped
+	if g.editMode {
+		if len(free) == 1 && !free[0].Pinched && free[0].Frames >= touchPaintFrames {
+			t.placing, t.placeX, t.placeY = true, free[0].X, free[0].Y
+		} else if t.tapped {
+			t.placing, t.placeX, t.placeY = true, t.tapX, t.tapY
+			t.tapped = false
+		}
+	}
+
+	g.input.SetTouch(t.actionValues())
+}
+
+// claimTouch gives a finger just put down to the joystick or the button
+// under it, if any
+func (g *MikoGameWithWorshippers) claimTouch(p touchPoint, s *touchState) {
+	t := &g.touch
+	if !g.touchControlsShown() {
+		return
+	}
+	x, y := float64(p.X), float64(p.Y)
+	for _, b := range t.buttons {
+		if x >= b.X && x < b.X+touchButtonWidth && y >= b.Y && y < b.Y+touchButtonHeight {
+			s.Button, s.Action = true, b.Action
+			return
+		}
+	}
+	if g.touchStickShown() && !t.stickHeld && math.Hypot(x-touchStickX, y-touchStickY) <= touchStickGrab {
+		t.stick, t.stickHeld = p.ID, true
+	}
+}
+
+// actionValues returns how far the joystick and buttons hold each action down
+func (t *TouchControls) actionValues() []float64 {
+	values := make([]float64, inputActionCount)
+	for _, s := range t.touches {
+		if s.Button {
+			values[s.Action] = 1
+		}
+	}
+	if t.stickHeld {
+		// The same dead zone as a gamepad stick, so a finger resting on the knob does not walk
+		x, y := t.stickX/touchStickRadius, t.stickY/touchStickRadius
+		if d := math.Hypot(x, y); d > input.StickDeadZone {
+			scale := (d - input.StickDeadZone) / (1 - input.StickDeadZone) / d
+			values[InputMoveRight] = math.Max(0, x*scale)
+			values[InputMoveLeft] = math.Max(0, -x*scale)
+			values[InputMoveDown] = math.Max(0, y*scale)
+			values[InputMoveUp] = math.Max(0, -y*scale)
+		}
+	}
+	return values
+}
+
+// touchButtons lays out the on-screen buttons for what is on screen, in a
+// column at the bottom right
+func (g *MikoGameWithWorshippers) touchButtons() []touchButton {
+	var buttons []touchButton
+	add := func(action InputAction, label string) {
+		buttons = append(buttons, touchButton{Action: action, Label: label})
+	}
+	switch {
+	case g.rebind.Open:
+		return nil
+	case g.visitorBook.Open:
+		add(InputPageUp, "前のページ")
+		add(InputPageDown, "次のページ")
+		add(InputVisitorBook, "名簿を閉じる")
+	case g.editMode:
+		add(InputTilePrevX, "タイルX -")
+		add(InputTileNextX, "タイルX +")
+		add(InputTilePrevY, "タイルY -")
+		add(InputTileNextY, "タイルY +")
+		add(InputCameraReset, "カメラリセット")
+		add(InputToggleEditor, "編集をやめる")
+	case g.interaction.Target != nil:
+		for i, option := range g.interaction.Options {
+			if i < len(interactionChoices) {
+				add(interactionChoices[i], interactionNames[option])
+			}
+		}
+		add(InputCancel, "閉じる")
+	case g.player.Inside:
+		add(InputInteract, "拝殿から出る")
+	default:
+		label := "話しかける"
+		if action, _ := g.facedTileAction(); action != nil {
+			label = action.Name
+		}
+		add(InputInteract, label)
+		add(InputChore, "お勤め")
+		add(InputVisitorBook, "参拝者名簿")
+		add(InputToggleEditor, "編集モード")
+	}
+
+	top := mikoScreenHeight - touchButtonMargin - float64(len(buttons))*(touchButtonHeight+touchButtonGap) + touchButtonGap
+	for i := range buttons {
+		buttons[i].X = mikoScreenWidth - touchButtonMargin - touchButtonWidth
+		buttons[i].Y = top + float64(i)*(touchButtonHeight+touchButtonGap)
+	}
+	return buttons
+}
+
+// zoomAt zooms the view, keeping the point under the screen position x, y
+// where it is
+func (t *TouchControls) zoomAt(zoom, x, y float64) {
+	zoom = math.Max(touchZoomMin, math.Min(touchZoomMax, zoom))
+	wx, wy := t.ViewX+x/t.Zoom, t.ViewY+y/t.Zoom
+	t.Zoom = zoom
+	t.ViewX, t.ViewY = wx-x/zoom, wy-y/zoom
+	t.clampView()
+}
+
+// pan moves the zoomed view with fingers dragged by dx, dy on the screen
+func (t *TouchControls) pan(dx, dy float64) {
+	t.ViewX -= dx / t.Zoom
+	t.ViewY -= dy / t.Zoom
+	t.clampView()
+}
+
+// centerView centers the zoomed view on a point of the unzoomed screen
+func (t *TouchControls) centerView(x, y float64) {
+	t.ViewX = x - mikoScreenWidth/(2*t.Zoom)
+	t.ViewY = y - mikoScreenHeight/(2*t.Zoom)
+	t.clampView()
+}
+
+// clampView keeps the zoomed view on the screen
+func (t *TouchControls) clampView() {
+	t.ViewX = math.Max(0, math.Min(mikoScreenWidth-mikoScreenWidth/t.Zoom, t.ViewX))
+	t.ViewY = math.Max(0, math.Min(mikoScreenHeight-mikoScreenHeight/t.Zoom, t.ViewY))
+}
+
+// resetZoom shows the whole screen again
+func (t *TouchControls) resetZoom() {
+	t.Zoom, t.ViewX, t.ViewY = touchZoomMin, 0, 0
+}
+
+// unzoom returns the point of the unzoomed screen shown at x, y
+func (t *TouchControls) unzoom(x, y int) (float64, float64) {
+	return t.ViewX + float64(x)/t.Zoom, t.ViewY + float64(y)/t.Zoom
+}
+
+// worldLayer returns the image to draw the world on: the screen itself, or
+// while zoomed in a layer that drawZoomed then scales up onto it
+func (t *TouchControls) worldLayer(screen *ebiten.Image) *ebiten.Image {
+	if t.Zoom <= touchZoomMin {
+		return screen
+	}
+	if t.layer == nil {
+		t.layer = ebiten.NewImage(mikoScreenWidth, mikoScreenHeight)
+	}
+	return t.layer
+}
+
+// drawZoomed draws the zoomed view of the world layer onto the screen
+func (t *TouchControls) drawZoomed(screen, world *ebiten.Image) {
+	if world == screen {
+		return
+	}
+	op := &ebiten.DrawImageOptions{}
+	op.GeoM.Translate(-t.ViewX, -t.ViewY)
+	op.GeoM.Scale(t.Zoom, t.Zoom)
+	op.Filter = ebiten.FilterLinear
+	screen.DrawImage(world, op)
+}
+
+// drawTouchControls draws the joystick and the buttons over the HUD
+func (g *MikoGameWithWorshippers) drawTouchControls(screen *ebiten.Image) {
+	t := &g.touch
+	if !g.touchControlsShown() {
+		return
+	}
+
+	if g.touchStickShown() {
+		ebitenutil.DrawCircle(screen, touchStickX, touchStickY, touchStickRadius, color.RGBA{255, 255, 255, 50})
+		ebitenutil.DrawCircle(screen, touchStickX+t.stickX, touchStickY+t.stickY, touchStickRadius/2, color.RGBA{255, 255, 255, 140})
+	}
+
+	held := t.actionValues()
+	for _, b := range t.buttons {
+		fill := color.RGBA{20, 30, 50, 170}
+		if held[b.Action] > 0 {
+			fill = color.RGBA{90, 70, 20, 220}
+		}
+		ebitenutil.DrawRect(screen, b.X, b.Y, touchButtonWidth, touchButtonHeight, fill)
+		drawText(screen, b.Label, b.X+12, b.Y+(touchButtonHeight-textLineHeight)/2)
+	}
+}